@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cdrgenerator/output"
+)
+
+// Actions recorded outside the API. API requests are recorded under an
+// action named after their path, such as "control.pause".
+const (
+	ActionServiceStart = "service.start"
+	ActionServiceStop  = "service.stop"
+	ActionConfigReload = "config.reload"
+	ActionChannelState = "channel.state"
+)
+
+// SystemActor is the actor of entries not caused by an API request
+const SystemActor = "system"
+
+// recentSize is how many entries are kept in memory
+const recentSize = 1000
+
+// Entry is one change recorded in the audit log
+type Entry struct {
+	Time   time.Time   `json:"time"`
+	Actor  string      `json:"actor"`          // User or token name, or "system"
+	Role   string      `json:"role,omitempty"` // The actor's API role
+	Addr   string      `json:"addr,omitempty"` // Remote address of the request
+	Action string      `json:"action"`
+	Device string      `json:"device,omitempty"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+	Error  string      `json:"error,omitempty"` // Set if the action failed
+}
+
+// Query selects audit entries. Empty fields match everything.
+type Query struct {
+	From   time.Time
+	To     time.Time
+	Actor  string
+	Action string // An action, or a prefix such as "control"
+	Device string
+	Limit  int // Newest entries to return; 0 for all
+}
+
+// Match returns true if the query selects e
+func (q Query) Match(e Entry) bool {
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Time.Before(q.To) {
+		return false
+	}
+	if q.Actor != "" && q.Actor != e.Actor {
+		return false
+	}
+	if q.Action != "" && q.Action != e.Action && !strings.HasPrefix(e.Action, q.Action+".") {
+		return false
+	}
+	if q.Device != "" && q.Device != e.Device {
+		return false
+	}
+	return true
+}
+
+// Log records who changed what. Entries are appended to a JSONL file if
+// one is configured, and the most recent are kept in memory.
+type Log struct {
+	path   string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	file   *os.File
+	recent []Entry // Oldest first
+
+	events *output.EventBus
+	sub    *output.Subscription
+}
+
+// Open opens the audit log, appending to path if it is set
+func Open(path string, logger *slog.Logger) (*Log, error) {
+	l := &Log{path: path, logger: logger}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		l.file = file
+	}
+	return l, nil
+}
+
+// Record adds an entry. A zero time is set to now. Failing to write the
+// file is logged, as the change itself has already been made.
+func (l *Log) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.recent = append(l.recent, e)
+	if len(l.recent) > recentSize {
+		l.recent = l.recent[len(l.recent)-recentSize:]
+	}
+
+	if l.file == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		_, err = l.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		l.logger.Error("Failed to write audit log", "error", err, "action", e.Action)
+	}
+}
+
+// Query returns the entries q selects, newest first. With a file the
+// whole file is searched, so entries from earlier runs are included.
+func (l *Log) Query(q Query) ([]Entry, error) {
+	var matches []Entry
+	keep := func(e Entry) {
+		if !q.Match(e) {
+			return
+		}
+		matches = append(matches, e)
+		if q.Limit > 0 && len(matches) > q.Limit {
+			matches = matches[1:]
+		}
+	}
+
+	if l.path == "" {
+		l.mu.Lock()
+		for _, e := range l.recent {
+			keep(e)
+		}
+		l.mu.Unlock()
+	} else if err := l.scanFile(keep); err != nil {
+		return nil, err
+	}
+
+	// Newest first
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches, nil
+}
+
+func (l *Log) scanFile(fn func(Entry)) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A line still being written, or damaged by a crash
+			continue
+		}
+		fn(e)
+	}
+	return scanner.Err()
+}
+
+// FollowChannels records the state changes of the channels publishing to
+// events, until the log is closed
+func (l *Log) FollowChannels(events *output.EventBus) {
+	l.events = events
+	l.sub = events.Subscribe(output.EventFilter{Types: []string{output.EventState}}, 256)
+	go func() {
+		for e := range l.sub.C {
+			l.Record(Entry{
+				Time:   e.Time,
+				Actor:  SystemActor,
+				Action: ActionChannelState,
+				Device: e.Device,
+				Before: e.PreviousState,
+				After:  e.State,
+			})
+		}
+	}()
+}
+
+// Close stops following channels and closes the file
+func (l *Log) Close() error {
+	if l.sub != nil {
+		l.events.Unsubscribe(l.sub)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -2,10 +2,23 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// Device schemes for non-serial outputs
+const (
+	PTYScheme  = "pty://"
+	TCPScheme  = "tcp://"
+	FileScheme = "file://"
+)
+
+// LinkFaultKinds lists the link faults a channel can simulate
+var LinkFaultKinds = []string{"drop", "dtr", "rts", "break", "silent"}
+
 // Config is the root configuration structure
 type Config struct {
 	App        AppConfig        `json:"app"`
@@ -21,23 +34,141 @@ type Config struct {
 type AppConfig struct {
 	Name       string `json:"name"`
 	InstanceID string `json:"instance_id"`
+
+	// Reload the configuration automatically when the file changes
+	WatchConfig bool `json:"watch_config,omitempty"`
+
+	// Exit with a summary once every port has finished its schedule
+	ExitWhenFinished bool `json:"exit_when_finished,omitempty"`
+
+	// Save each channel's position and totals here, and resume from it on
+	// startup, so call IDs do not repeat after a restart
+	StateFile            string `json:"state_file,omitempty"`
+	StateSaveIntervalSec int    `json:"state_save_interval_sec,omitempty"`
+
+	// Write a JSONL ledger of every record sent, one file per port
+	LedgerDir string `json:"ledger_dir,omitempty"`
+
+	// Append the audit log of changes to this JSONL file. Without it only
+	// the most recent entries are kept, in memory.
+	AuditLog string `json:"audit_log,omitempty"`
 }
 
 // PortConfig defines configuration for a single serial port
 type PortConfig struct {
-	Device         string           `json:"device"`
-	BaudRate       int              `json:"baud_rate"`
-	DataBits       int              `json:"data_bits"`
-	StopBits       int              `json:"stop_bits"`
-	Parity         string           `json:"parity"`
-	Format         string           `json:"format"`
-	Mode           string           `json:"mode"`
-	SampleFile     string           `json:"sample_file,omitempty"`
-	Loop           bool             `json:"loop,omitempty"`
-	CallsPerMinute float64          `json:"calls_per_minute"`
-	Enabled        bool             `json:"enabled"`
-	Description    string           `json:"description,omitempty"`
-	Synthetic      *SyntheticConfig `json:"synthetic,omitempty"`
+	Device           string            `json:"device"`
+	BaudRate         int               `json:"baud_rate"`
+	DataBits         int               `json:"data_bits"`
+	StopBits         int               `json:"stop_bits"`
+	Parity           string            `json:"parity"`
+	FlowControl      string            `json:"flow_control,omitempty"`        // "none", "rtscts", "xonxoff"
+	CTSTimeoutMs     int               `json:"cts_timeout_ms,omitempty"`      // Maximum wait for CTS per write
+	PaceOutput       bool              `json:"pace_output,omitempty"`         // Release bytes at baud_rate on non-serial devices
+	InterCharDelayMs float64           `json:"inter_char_delay_ms,omitempty"` // Extra gap after every character
+	Format           string            `json:"format"`
+	Mode             string            `json:"mode"`
+	SampleFile       string            `json:"sample_file,omitempty"`
+	Loop             bool              `json:"loop,omitempty"`
+	CallsPerMinute   float64           `json:"calls_per_minute"`
+	OutputMode       string            `json:"output_mode,omitempty"`    // "block" (end of call) or "stream" (line by line)
+	StreamSpeedup    float64           `json:"stream_speedup,omitempty"` // Stream mode: compress call time by this factor
+	Enabled          bool              `json:"enabled"`
+	Description      string            `json:"description,omitempty"`
+	Synthetic        *SyntheticConfig  `json:"synthetic,omitempty"`
+	PTYLink          string            `json:"pty_link,omitempty"`    // Symlink to the slave for pty:// devices
+	HTTP             *HTTPConfig       `json:"http,omitempty"`        // Settings for http:// and https:// devices
+	Tee              []TeeConfig       `json:"tee,omitempty"`         // Extra devices receiving the same records
+	Receive          *ReceiveConfig    `json:"receive,omitempty"`     // Read and react to collector responses
+	Framing          *FramingConfig    `json:"framing,omitempty"`     // Wire format: line endings, charset, wrappers
+	Faults           *FaultConfig      `json:"faults,omitempty"`      // Deliberately corrupt output for robustness tests
+	LinkFaults       []LinkFaultConfig `json:"link_faults,omitempty"` // Scheduled outages of the whole link
+	Schedule         *ScheduleConfig   `json:"schedule,omitempty"`    // When to send and when to finish
+}
+
+// ScheduleConfig limits when a port sends records and how long it runs.
+// Times are in the local time zone.
+type ScheduleConfig struct {
+	StartAt        string         `json:"start_at,omitempty"`         // RFC 3339 time, or "15:04" for its next occurrence
+	StopAt         string         `json:"stop_at,omitempty"`          // RFC 3339 time, or "15:04" for its next occurrence after start
+	Windows        []WindowConfig `json:"windows,omitempty"`          // Only send inside these windows
+	MaxRecords     int64          `json:"max_records,omitempty"`      // Finish after this many scheduled records
+	MaxDurationSec int            `json:"max_duration_sec,omitempty"` // Finish this long after the start
+}
+
+// WindowConfig is a recurring daily period in which a port sends records
+type WindowConfig struct {
+	Days  []string `json:"days,omitempty"` // "mon" to "sun"; empty means every day
+	Start string   `json:"start"`          // "15:04"
+	End   string   `json:"end"`            // "15:04"; at or before start means the next day
+}
+
+// LinkFaultConfig schedules a recurring link fault: "drop" closes the
+// device, "dtr"/"rts" lower that modem line, "break" sends a serial break
+// and "silent" stops transmitting with the device left open
+type LinkFaultConfig struct {
+	Kind        string `json:"kind"`
+	IntervalSec int    `json:"interval_sec"` // Time between faults
+	DurationMs  int    `json:"duration_ms"`  // How long each fault lasts
+}
+
+// FaultConfig sets the probability (0-1) of each fault being injected into
+// a record, or into a line in stream mode. Duplicate and split are not
+// applied to tees.
+type FaultConfig struct {
+	Enabled       bool    `json:"enabled"`
+	Seed          int64   `json:"seed,omitempty"` // 0 picks a random seed
+	Truncate      float64 `json:"truncate,omitempty"`
+	DropLine      float64 `json:"drop_line,omitempty"`
+	Duplicate     float64 `json:"duplicate,omitempty"`
+	Garbage       float64 `json:"garbage,omitempty"`
+	ControlBytes  float64 `json:"control_bytes,omitempty"`
+	BitFlip       float64 `json:"bit_flip,omitempty"`
+	Split         float64 `json:"split,omitempty"`
+	SplitPauseMs  int     `json:"split_pause_ms,omitempty"` // Gap between the two halves of a split record
+	OmitSeparator float64 `json:"omit_separator,omitempty"`
+}
+
+// FramingConfig controls how record lines are encoded on the wire
+type FramingConfig struct {
+	LineEnding   string `json:"line_ending"`             // "lf", "crlf", "cr" or "none"
+	RecordPrefix string `json:"record_prefix,omitempty"` // Bytes before each record, e.g. "\u0002" (STX)
+	RecordSuffix string `json:"record_suffix,omitempty"` // Bytes after each record, e.g. "\u0003" (ETX) or "\f"
+	Charset      string `json:"charset"`                 // "utf8", "latin1" or "ascii"
+	ParityBit    string `json:"parity_bit"`              // ascii only: "none", "even", "odd", "mark", "space" in bit 7
+	LineWidth    int    `json:"line_width,omitempty"`    // Pad lines with spaces to this many characters
+}
+
+// ReceiveConfig controls reading bytes sent back by the collector
+type ReceiveConfig struct {
+	Enabled        bool   `json:"enabled"`
+	LogData        bool   `json:"log_data"`     // Log every chunk received
+	AckRequired    bool   `json:"ack_required"` // Retransmit records that are not acknowledged
+	AckChar        string `json:"ack_char"`     // Default ASCII ACK (0x06)
+	NakChar        string `json:"nak_char"`     // Default ASCII NAK (0x15)
+	AckTimeoutMs   int    `json:"ack_timeout_ms"`
+	MaxRetransmits *int   `json:"max_retransmits"` // 0 disables retransmission; default 3
+}
+
+// TeeConfig defines an additional device that receives a copy of every
+// record written by a port. With fault injection, the copy carries the
+// same corrupted bytes, but is written once and whole: duplicate and split
+// faults only apply to the port itself.
+type TeeConfig struct {
+	Device     string      `json:"device"`
+	BufferSize int         `json:"buffer_size,omitempty"` // Records queued before drops
+	PTYLink    string      `json:"pty_link,omitempty"`
+	HTTP       *HTTPConfig `json:"http,omitempty"`
+}
+
+// HTTPConfig contains settings for HTTP webhook devices
+type HTTPConfig struct {
+	Payload          string            `json:"payload"` // "raw" or "json"
+	TimeoutSec       int               `json:"timeout_sec"`
+	MaxRetries       *int              `json:"max_retries"` // 0 disables retries; default 3
+	RetryDelayMs     int               `json:"retry_delay_ms"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	BatchSize        int               `json:"batch_size,omitempty"`
+	BatchIntervalSec int               `json:"batch_interval_sec,omitempty"`
 }
 
 // SyntheticConfig contains settings for synthetic data generation
@@ -67,8 +198,93 @@ type LoggingConfig struct {
 
 // MonitoringConfig defines HTTP monitoring settings
 type MonitoringConfig struct {
-	Port             int `json:"port"`
-	StatsIntervalSec int `json:"stats_interval_sec"`
+	Port             int         `json:"port"`
+	BindAddress      string      `json:"bind_address,omitempty"` // Interface to listen on, e.g. "127.0.0.1"; empty for all
+	StatsIntervalSec int         `json:"stats_interval_sec"`
+	Auth             *AuthConfig `json:"auth,omitempty"` // Require credentials; nil leaves the API open
+	TLS              *TLSConfig  `json:"tls,omitempty"`  // Serve HTTPS; nil for plain HTTP
+
+	// Number of configs saved through the API to keep for diff and rollback
+	ConfigHistory int `json:"config_history,omitempty"`
+}
+
+// TLSConfig enables HTTPS for the monitoring server. The files are read
+// again when they change, so certificates can be renewed without a restart.
+type TLSConfig struct {
+	CertFile        string `json:"cert_file"`                   // PEM certificate chain
+	KeyFile         string `json:"key_file"`                    // PEM private key
+	ClientCAFile    string `json:"client_ca_file,omitempty"`    // Verify client certificates against these CAs
+	AdminClientCert bool   `json:"admin_client_cert,omitempty"` // Require a verified client certificate for admin requests
+}
+
+// API roles
+const (
+	RoleRead  = "read"  // View the dashboard, stats, records and config
+	RoleAdmin = "admin" // Also change the config and control channels
+)
+
+// RedactedSecret replaces tokens and passwords in a config served by the
+// API. Saving a config with it keeps the stored secret.
+const RedactedSecret = "********"
+
+// AuthConfig lists the credentials accepted by the monitoring API. Each
+// request must carry a bearer token or HTTP basic credentials.
+type AuthConfig struct {
+	Tokens        []AuthToken `json:"tokens,omitempty"`
+	Users         []AuthUser  `json:"users,omitempty"`
+	AnonymousRead bool        `json:"anonymous_read,omitempty"` // Allow read access without credentials
+}
+
+// AuthToken is an API token, sent as "Authorization: Bearer <token>"
+type AuthToken struct {
+	Name  string `json:"name"` // Identifies the caller in logs
+	Token string `json:"token"`
+	Role  string `json:"role"` // "read" or "admin"
+}
+
+// AuthUser is an HTTP basic auth login, used by the dashboard
+type AuthUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"` // "read" or "admin"
+}
+
+// Redact replaces every token and password with RedactedSecret
+func (a *AuthConfig) Redact() {
+	for i := range a.Tokens {
+		a.Tokens[i].Token = RedactedSecret
+	}
+	for i := range a.Users {
+		a.Users[i].Password = RedactedSecret
+	}
+}
+
+// RestoreSecrets puts back the secrets of old wherever a has the redacted
+// placeholder, matching tokens by name and users by username
+func (a *AuthConfig) RestoreSecrets(old *AuthConfig) {
+	if old == nil {
+		return
+	}
+	for i, t := range a.Tokens {
+		if t.Token != RedactedSecret {
+			continue
+		}
+		for _, o := range old.Tokens {
+			if o.Name == t.Name {
+				a.Tokens[i].Token = o.Token
+			}
+		}
+	}
+	for i, u := range a.Users {
+		if u.Password != RedactedSecret {
+			continue
+		}
+		for _, o := range old.Users {
+			if o.Username == u.Username {
+				a.Users[i].Password = o.Password
+			}
+		}
+	}
 }
 
 // SlackConfig defines Slack notification settings
@@ -92,7 +308,11 @@ func Load(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return Parse(data)
+}
 
+// Parse parses the contents of a configuration file and applies defaults
+func Parse(data []byte) (*Config, error) {
 	var cfg Config
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
@@ -104,6 +324,49 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
+// ParsePort parses the configuration of a single port, such as one sent for
+// a preview, and applies the defaults it would get in a config file
+func ParsePort(data []byte) (*PortConfig, error) {
+	var port PortConfig
+	if err := json.Unmarshal(data, &port); err != nil {
+		return nil, err
+	}
+	port.applyDefaults()
+	return &port, nil
+}
+
+// WriteFile writes data to path atomically: it goes to a temporary file in
+// the same directory, which then replaces path, so a crash mid-write leaves
+// the old file intact. An existing file keeps its permissions; a new one
+// gets perm.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
 // applyDefaults sets default values for unspecified fields
 func (c *Config) applyDefaults() {
 	// App defaults
@@ -114,24 +377,13 @@ func (c *Config) applyDefaults() {
 		hostname, _ := os.Hostname()
 		c.App.InstanceID = hostname
 	}
+	if c.App.StateFile != "" && c.App.StateSaveIntervalSec == 0 {
+		c.App.StateSaveIntervalSec = 60
+	}
 
 	// Port defaults
 	for i := range c.Ports {
-		if c.Ports[i].BaudRate == 0 {
-			c.Ports[i].BaudRate = 9600
-		}
-		if c.Ports[i].DataBits == 0 {
-			c.Ports[i].DataBits = 8
-		}
-		if c.Ports[i].StopBits == 0 {
-			c.Ports[i].StopBits = 1
-		}
-		if c.Ports[i].Parity == "" {
-			c.Ports[i].Parity = "none"
-		}
-		if c.Ports[i].CallsPerMinute == 0 {
-			c.Ports[i].CallsPerMinute = 1.0
-		}
+		c.Ports[i].applyDefaults()
 	}
 
 	// Timing defaults
@@ -160,6 +412,9 @@ func (c *Config) applyDefaults() {
 	if c.Monitoring.StatsIntervalSec == 0 {
 		c.Monitoring.StatsIntervalSec = 60
 	}
+	if c.Monitoring.ConfigHistory == 0 {
+		c.Monitoring.ConfigHistory = 20
+	}
 
 	// Recovery defaults
 	if c.Recovery.ReconnectDelaySec == 0 {
@@ -170,6 +425,192 @@ func (c *Config) applyDefaults() {
 	}
 }
 
+// applyDefaults sets default values for unspecified port fields
+func (p *PortConfig) applyDefaults() {
+	if p.BaudRate == 0 {
+		p.BaudRate = 9600
+	}
+	if p.DataBits == 0 {
+		p.DataBits = 8
+	}
+	if p.StopBits == 0 {
+		p.StopBits = 1
+	}
+	if p.Parity == "" {
+		p.Parity = "none"
+	}
+	if p.CallsPerMinute == 0 {
+		p.CallsPerMinute = 1.0
+	}
+	if p.OutputMode == "" {
+		p.OutputMode = "block"
+	}
+	if p.StreamSpeedup == 0 {
+		p.StreamSpeedup = 1.0
+	}
+	if p.FlowControl == "" {
+		p.FlowControl = "none"
+	}
+	if p.CTSTimeoutMs == 0 {
+		p.CTSTimeoutMs = 5000
+	}
+	if p.IsHTTP() {
+		if p.HTTP == nil {
+			p.HTTP = &HTTPConfig{}
+		}
+		p.HTTP.applyDefaults()
+	}
+	if r := p.Receive; r != nil {
+		if r.AckChar == "" {
+			r.AckChar = "\x06"
+		}
+		if r.NakChar == "" {
+			r.NakChar = "\x15"
+		}
+		if r.AckTimeoutMs == 0 {
+			r.AckTimeoutMs = 2000
+		}
+		if r.MaxRetransmits == nil {
+			r.MaxRetransmits = intPtr(3)
+		}
+	}
+	if p.Framing == nil {
+		p.Framing = &FramingConfig{}
+	}
+	p.Framing.applyDefaults()
+	if f := p.Faults; f != nil && f.SplitPauseMs == 0 {
+		f.SplitPauseMs = 5000
+	}
+	for j := range p.Tee {
+		tee := &p.Tee[j]
+		if tee.BufferSize == 0 {
+			tee.BufferSize = 100
+		}
+		if isHTTPDevice(tee.Device) {
+			if tee.HTTP == nil {
+				tee.HTTP = &HTTPConfig{}
+			}
+			tee.HTTP.applyDefaults()
+		}
+	}
+}
+
+// applyDefaults sets default values for unspecified webhook fields
+func (h *HTTPConfig) applyDefaults() {
+	if h.Payload == "" {
+		h.Payload = "json"
+	}
+	if h.TimeoutSec == 0 {
+		h.TimeoutSec = 10
+	}
+	if h.MaxRetries == nil {
+		h.MaxRetries = intPtr(3)
+	}
+	if h.RetryDelayMs == 0 {
+		h.RetryDelayMs = 1000
+	}
+	if h.BatchSize > 1 && h.BatchIntervalSec == 0 {
+		h.BatchIntervalSec = 5
+	}
+}
+
+// applyDefaults sets default values for unspecified framing fields. The
+// defaults match plain record output: LF line endings, UTF-8, no wrapper.
+func (f *FramingConfig) applyDefaults() {
+	if f.LineEnding == "" {
+		f.LineEnding = "lf"
+	}
+	if f.Charset == "" {
+		f.Charset = "utf8"
+	}
+	if f.ParityBit == "" {
+		f.ParityBit = "none"
+	}
+}
+
+// GetSplitPause returns the pause inside a split record as a duration
+func (f *FaultConfig) GetSplitPause() time.Duration {
+	return time.Duration(f.SplitPauseMs) * time.Millisecond
+}
+
+// GetStateSaveInterval returns the time between state file saves as a duration
+func (a *AppConfig) GetStateSaveInterval() time.Duration {
+	return time.Duration(a.StateSaveIntervalSec) * time.Second
+}
+
+// GetMaxDuration returns the maximum run time as a duration
+func (s *ScheduleConfig) GetMaxDuration() time.Duration {
+	return time.Duration(s.MaxDurationSec) * time.Second
+}
+
+// Finite returns true if the schedule ends, so the port eventually finishes
+func (s *ScheduleConfig) Finite() bool {
+	return s.StopAt != "" || s.MaxRecords > 0 || s.MaxDurationSec > 0
+}
+
+// ScheduleDays maps day names in window configs to weekdays
+var ScheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseScheduleTime parses a schedule start or stop time. An RFC 3339 time
+// is used as is; a time of day ("15:04") means its next occurrence after
+// the given time.
+func ParseScheduleTime(value string, after time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	clock, err := ParseTimeOfDay(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: must be RFC 3339 or HH:MM", value)
+	}
+
+	t := AtTimeOfDay(after, clock)
+	if !t.After(after) {
+		t = AtTimeOfDay(after.AddDate(0, 0, 1), clock)
+	}
+	return t, nil
+}
+
+// ParseTimeOfDay parses "15:04" into the offset from midnight
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: must be HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// AtTimeOfDay returns the time on day's date at the given offset from
+// midnight, in day's time zone
+func AtTimeOfDay(day time.Time, clock time.Duration) time.Time {
+	y, m, d := day.Date()
+	hour, minute := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+	return time.Date(y, m, d, hour, minute, 0, 0, day.Location())
+}
+
+// GetInterval returns the time between scheduled faults as a duration
+func (l *LinkFaultConfig) GetInterval() time.Duration {
+	return time.Duration(l.IntervalSec) * time.Second
+}
+
+// GetDuration returns how long each fault lasts as a duration
+func (l *LinkFaultConfig) GetDuration() time.Duration {
+	return time.Duration(l.DurationMs) * time.Millisecond
+}
+
+// GetAckTimeout returns the ACK wait as a duration
+func (r *ReceiveConfig) GetAckTimeout() time.Duration {
+	return time.Duration(r.AckTimeoutMs) * time.Millisecond
+}
+
 // GetReconnectDelay returns the initial reconnect delay as a duration
 func (c *RecoveryConfig) GetReconnectDelay() time.Duration {
 	return time.Duration(c.ReconnectDelaySec) * time.Second
@@ -184,3 +625,76 @@ func (c *RecoveryConfig) GetMaxReconnectDelay() time.Duration {
 func (c *TimingConfig) GetStartupDelay() time.Duration {
 	return time.Duration(c.StartupDelaySec) * time.Second
 }
+
+// IsPTY returns true if the device is a built-in pty:// pair
+func (p *PortConfig) IsPTY() bool {
+	return strings.HasPrefix(p.Device, PTYScheme)
+}
+
+// PTYName returns the name portion of a pty:// device
+func (p *PortConfig) PTYName() string {
+	return strings.TrimPrefix(p.Device, PTYScheme)
+}
+
+// IsHTTP returns true if the device is an http:// or https:// webhook
+func (p *PortConfig) IsHTTP() bool {
+	return isHTTPDevice(p.Device)
+}
+
+// IsTCP returns true if the device is a tcp://host:port connection
+func (p *PortConfig) IsTCP() bool {
+	return strings.HasPrefix(p.Device, TCPScheme)
+}
+
+// IsFile returns true if the device is a file:// capture file
+func (p *PortConfig) IsFile() bool {
+	return strings.HasPrefix(p.Device, FileScheme)
+}
+
+// FilePath returns the path portion of a file:// device
+func (p *PortConfig) FilePath() string {
+	return strings.TrimPrefix(p.Device, FileScheme)
+}
+
+// TeePortConfig returns the port configuration used to open a tee device.
+// Serial settings are inherited from the parent port.
+func (p *PortConfig) TeePortConfig(tee TeeConfig) PortConfig {
+	cfg := *p
+	cfg.Device = tee.Device
+	cfg.PTYLink = tee.PTYLink
+	cfg.HTTP = tee.HTTP
+	cfg.Tee = nil
+	return cfg
+}
+
+func isHTTPDevice(device string) bool {
+	return strings.HasPrefix(device, "http://") || strings.HasPrefix(device, "https://")
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// IsStreaming returns true if records are written line by line as call
+// events happen
+func (p *PortConfig) IsStreaming() bool {
+	return p.OutputMode == "stream"
+}
+
+// GetInterCharDelay returns the extra per-character gap as a duration
+func (p *PortConfig) GetInterCharDelay() time.Duration {
+	return time.Duration(p.InterCharDelayMs * float64(time.Millisecond))
+}
+
+// GetCTSTimeout returns the maximum wait for CTS as a duration
+func (p *PortConfig) GetCTSTimeout() time.Duration {
+	return time.Duration(p.CTSTimeoutMs) * time.Millisecond
+}
+
+// GetPTYLink returns the symlink path for a pty:// device
+func (p *PortConfig) GetPTYLink() string {
+	if p.PTYLink != "" {
+		return p.PTYLink
+	}
+	return filepath.Join(os.TempDir(), "cdrgenerator", p.PTYName())
+}
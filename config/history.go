@@ -0,0 +1,204 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownVersion is returned for a config version not in the history
+var ErrUnknownVersion = errors.New("unknown config version")
+
+// Version describes one saved version of the configuration file
+type Version struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Author  string    `json:"author"`         // Who saved it; "file" for edits made outside the API
+	Note    string    `json:"note,omitempty"` // Why it was saved, e.g. a rollback
+}
+
+// History keeps the last versions of the configuration file in a
+// directory. Each version is stored as an exact copy of the file,
+// NNNNNN.json, next to its description, NNNNNN.meta.json. The copies hold
+// the API credentials, so only the owner can read them.
+type History struct {
+	dir   string
+	limit int
+
+	mu sync.Mutex
+}
+
+// NewHistory creates a history in dir that keeps the newest limit versions
+func NewHistory(dir string, limit int) *History {
+	if limit < 1 {
+		limit = 1
+	}
+	return &History{dir: dir, limit: limit}
+}
+
+// HistoryDir returns the history directory for a config file
+func HistoryDir(configPath string) string {
+	return configPath + ".history"
+}
+
+// Record stores data as a new version and drops the oldest versions beyond
+// the limit
+func (h *History) Record(data []byte, author, note string) (Version, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := os.MkdirAll(h.dir, 0700); err != nil {
+		return Version{}, err
+	}
+
+	numbers, err := h.numbers()
+	if err != nil {
+		return Version{}, err
+	}
+	next := 1
+	if len(numbers) > 0 {
+		next = numbers[len(numbers)-1] + 1
+	}
+
+	v := Version{Version: next, SavedAt: time.Now().UTC(), Author: author, Note: note}
+	meta, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return Version{}, err
+	}
+
+	// The copy goes first: a version without its description is not listed
+	if err := WriteFile(h.configFile(next), data, 0600); err != nil {
+		return Version{}, err
+	}
+	if err := WriteFile(h.metaFile(next), meta, 0600); err != nil {
+		return Version{}, err
+	}
+
+	numbers = append(numbers, next)
+	for len(numbers) > h.limit {
+		os.Remove(h.metaFile(numbers[0]))
+		os.Remove(h.configFile(numbers[0]))
+		numbers = numbers[1:]
+	}
+	return v, nil
+}
+
+// RecordIfChanged records data only if it differs from the newest version,
+// so edits made to the file outside the API are kept before they are
+// overwritten. It reports whether a version was recorded.
+func (h *History) RecordIfChanged(data []byte, author, note string) (bool, error) {
+	latest, ok, err := h.Latest()
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		_, stored, err := h.Get(latest.Version)
+		if err == nil && bytes.Equal(stored, data) {
+			return false, nil
+		}
+	}
+	_, err = h.Record(data, author, note)
+	return err == nil, err
+}
+
+// List returns the stored versions, newest first
+func (h *History) List() ([]Version, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	numbers, err := h.numbers()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]Version, 0, len(numbers))
+	for i := len(numbers) - 1; i >= 0; i-- {
+		v, err := h.readMeta(numbers[i])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// Latest returns the newest version; ok is false if there is none
+func (h *History) Latest() (v Version, ok bool, err error) {
+	versions, err := h.List()
+	if err != nil || len(versions) == 0 {
+		return Version{}, false, err
+	}
+	return versions[0], true, nil
+}
+
+// Get returns a version and the config file as it was saved
+func (h *History) Get(version int) (Version, []byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v, err := h.readMeta(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return Version{}, nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	if err != nil {
+		return Version{}, nil, err
+	}
+
+	data, err := os.ReadFile(h.configFile(version))
+	if err != nil {
+		return Version{}, nil, err
+	}
+	return v, data, nil
+}
+
+func (h *History) readMeta(version int) (Version, error) {
+	data, err := os.ReadFile(h.metaFile(version))
+	if err != nil {
+		return Version{}, err
+	}
+	var v Version
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Version{}, fmt.Errorf("failed to parse %s: %w", h.metaFile(version), err)
+	}
+	return v, nil
+}
+
+// numbers returns the version numbers in the directory, oldest first
+func (h *History) numbers() ([]int, error) {
+	entries, err := os.ReadDir(h.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var numbers []int
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".meta.json")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (h *History) configFile(version int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%06d.json", version))
+}
+
+func (h *History) metaFile(version int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%06d.meta.json", version))
+}
@@ -2,8 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // ValidationError contains details about configuration validation failures
@@ -41,10 +45,55 @@ func Validate(cfg *Config, availableFormats []string) error {
 
 	devicesSeen := make(map[string]bool)
 	for i, port := range cfg.Ports {
-		portErrors := validatePort(port, i, availableFormats, devicesSeen)
+		portErrors := validatePort(port, fmt.Sprintf("ports[%d]", i), availableFormats, devicesSeen)
 		errors = append(errors, portErrors...)
 	}
 
+	if cfg.App.ExitWhenFinished {
+		for i, port := range cfg.Ports {
+			if port.Enabled && (port.Schedule == nil || !port.Schedule.Finite()) {
+				errors = append(errors, ValidationError{
+					Field:   fmt.Sprintf("ports[%d].schedule", i),
+					Message: "app.exit_when_finished needs every enabled port to have stop_at, max_records or max_duration_sec",
+				})
+			}
+		}
+	}
+
+	if cfg.App.StateFile != "" {
+		if info, err := os.Stat(filepath.Dir(cfg.App.StateFile)); err != nil || !info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   "app.state_file",
+				Message: fmt.Sprintf("directory does not exist: %s", filepath.Dir(cfg.App.StateFile)),
+			})
+		}
+		if cfg.App.StateSaveIntervalSec < 0 {
+			errors = append(errors, ValidationError{
+				Field:   "app.state_save_interval_sec",
+				Message: "must not be negative",
+			})
+		}
+	}
+
+	if cfg.App.LedgerDir != "" {
+		if info, err := os.Stat(cfg.App.LedgerDir); err != nil || !info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   "app.ledger_dir",
+				Message: fmt.Sprintf("directory does not exist: %s", cfg.App.LedgerDir),
+			})
+		}
+	}
+
+	if cfg.App.AuditLog != "" {
+		dir := filepath.Dir(cfg.App.AuditLog)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			errors = append(errors, ValidationError{
+				Field:   "app.audit_log",
+				Message: fmt.Sprintf("directory does not exist: %s", dir),
+			})
+		}
+	}
+
 	// Validate timing
 	if cfg.Timing.JitterPercent < 0 || cfg.Timing.JitterPercent > 100 {
 		errors = append(errors, ValidationError{
@@ -70,6 +119,24 @@ func Validate(cfg *Config, availableFormats []string) error {
 			Message: "must be between 1 and 65535",
 		})
 	}
+	if addr := cfg.Monitoring.BindAddress; addr != "" && net.ParseIP(addr) == nil && strings.ContainsAny(addr, ":/ ") {
+		errors = append(errors, ValidationError{
+			Field:   "monitoring.bind_address",
+			Message: fmt.Sprintf("invalid address: %q (use an IP address or host name, without a port)", addr),
+		})
+	}
+	if cfg.Monitoring.Auth != nil {
+		errors = append(errors, validateAuth(cfg.Monitoring.Auth, "monitoring.auth")...)
+	}
+	if cfg.Monitoring.TLS != nil {
+		errors = append(errors, validateTLS(cfg.Monitoring.TLS, "monitoring.tls")...)
+	}
+	if cfg.Monitoring.ConfigHistory < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "monitoring.config_history",
+			Message: "must not be negative",
+		})
+	}
 
 	// Validate recovery
 	if cfg.Recovery.ReconnectDelaySec < 1 {
@@ -85,9 +152,17 @@ func Validate(cfg *Config, availableFormats []string) error {
 	return nil
 }
 
-func validatePort(port PortConfig, index int, availableFormats []string, devicesSeen map[string]bool) ValidationErrors {
+// ValidatePort checks the configuration of a single port on its own, such
+// as one sent for a preview
+func ValidatePort(port *PortConfig, availableFormats []string) error {
+	if errors := validatePort(*port, "port", availableFormats, make(map[string]bool)); len(errors) > 0 {
+		return errors
+	}
+	return nil
+}
+
+func validatePort(port PortConfig, prefix string, availableFormats []string, devicesSeen map[string]bool) ValidationErrors {
 	var errors ValidationErrors
-	prefix := fmt.Sprintf("ports[%d]", index)
 
 	// Check device
 	if port.Device == "" {
@@ -104,6 +179,37 @@ func validatePort(port PortConfig, index int, availableFormats []string, devices
 		devicesSeen[port.Device] = true
 	}
 
+	// Check scheme-specific settings
+	errors = append(errors, validateDevice(port, prefix)...)
+
+	// Check tee devices
+	for j, tee := range port.Tee {
+		teePrefix := fmt.Sprintf("%s.tee[%d]", prefix, j)
+		if tee.Device == "" {
+			errors = append(errors, ValidationError{
+				Field:   teePrefix + ".device",
+				Message: "device path is required",
+			})
+			continue
+		}
+		if devicesSeen[tee.Device] {
+			errors = append(errors, ValidationError{
+				Field:   teePrefix + ".device",
+				Message: fmt.Sprintf("duplicate device: %s", tee.Device),
+			})
+		}
+		devicesSeen[tee.Device] = true
+
+		if tee.BufferSize < 1 {
+			errors = append(errors, ValidationError{
+				Field:   teePrefix + ".buffer_size",
+				Message: "must be at least 1",
+			})
+		}
+
+		errors = append(errors, validateDevice(port.TeePortConfig(tee), teePrefix)...)
+	}
+
 	// Check baud rate
 	validBaudRates := []int{300, 1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200}
 	if !contains(validBaudRates, port.BaudRate) {
@@ -113,6 +219,36 @@ func validatePort(port PortConfig, index int, availableFormats []string, devices
 		})
 	}
 
+	// Check flow control; left out means none, as in the serial package
+	validFlowControl := []string{"", "none", "rtscts", "xonxoff"}
+	if !containsString(validFlowControl, port.FlowControl) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".flow_control",
+			Message: fmt.Sprintf("invalid flow control: %s (must be 'none', 'rtscts' or 'xonxoff')", port.FlowControl),
+		})
+	}
+
+	if port.CTSTimeoutMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".cts_timeout_ms",
+			Message: "must not be negative",
+		})
+	}
+
+	if port.InterCharDelayMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".inter_char_delay_ms",
+			Message: "must not be negative",
+		})
+	}
+
+	if (port.PaceOutput || port.InterCharDelayMs > 0) && port.IsHTTP() {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".pace_output",
+			Message: "pacing is not supported for http devices",
+		})
+	}
+
 	// Check format
 	if port.Format == "" {
 		errors = append(errors, ValidationError{
@@ -162,6 +298,72 @@ func validatePort(port PortConfig, index int, availableFormats []string, devices
 		}
 	}
 
+	// Check output mode
+	if !containsString([]string{"block", "stream"}, port.OutputMode) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".output_mode",
+			Message: fmt.Sprintf("invalid output mode: %s (must be 'block' or 'stream')", port.OutputMode),
+		})
+	}
+
+	if port.StreamSpeedup <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".stream_speedup",
+			Message: "must be greater than 0",
+		})
+	}
+
+	if port.IsStreaming() && port.Receive != nil && port.Receive.Enabled && port.Receive.AckRequired {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".receive.ack_required",
+			Message: "is not supported with stream output mode",
+		})
+	}
+
+	// Check receive settings
+	if port.Receive != nil && port.Receive.Enabled {
+		errors = append(errors, validateReceive(port.Receive, prefix)...)
+	}
+
+	if port.Framing != nil {
+		errors = append(errors, validateFraming(port.Framing, prefix)...)
+	}
+
+	if port.Faults != nil && port.Faults.Enabled {
+		errors = append(errors, validateFaults(port.Faults, prefix)...)
+	}
+
+	for i, lf := range port.LinkFaults {
+		lfPrefix := fmt.Sprintf("%s.link_faults[%d]", prefix, i)
+		if !containsString(LinkFaultKinds, lf.Kind) {
+			errors = append(errors, ValidationError{
+				Field:   lfPrefix + ".kind",
+				Message: fmt.Sprintf("invalid link fault: %s (must be one of %s)", lf.Kind, strings.Join(LinkFaultKinds, ", ")),
+			})
+		}
+		if lf.IntervalSec < 1 {
+			errors = append(errors, ValidationError{
+				Field:   lfPrefix + ".interval_sec",
+				Message: "must be at least 1",
+			})
+		}
+		if lf.DurationMs < 1 {
+			errors = append(errors, ValidationError{
+				Field:   lfPrefix + ".duration_ms",
+				Message: "must be at least 1",
+			})
+		} else if lf.DurationMs >= lf.IntervalSec*1000 {
+			errors = append(errors, ValidationError{
+				Field:   lfPrefix + ".duration_ms",
+				Message: "must be shorter than interval_sec",
+			})
+		}
+	}
+
+	if port.Schedule != nil {
+		errors = append(errors, validateSchedule(port.Schedule, prefix)...)
+	}
+
 	// Check calls per minute
 	if port.CallsPerMinute <= 0 {
 		errors = append(errors, ValidationError{
@@ -207,6 +409,277 @@ func validateSynthetic(synth *SyntheticConfig, prefix string) ValidationErrors {
 	return errors
 }
 
+// validateDevice checks scheme-specific device settings
+func validateDevice(port PortConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	if port.IsPTY() {
+		name := port.PTYName()
+		if name == "" || strings.ContainsAny(name, "/\\") {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".device",
+				Message: fmt.Sprintf("invalid pty name: %q (use pty://name)", name),
+			})
+		}
+	}
+
+	if port.IsHTTP() {
+		errors = append(errors, validateHTTP(port, prefix)...)
+	}
+
+	if port.IsTCP() {
+		if _, _, err := net.SplitHostPort(strings.TrimPrefix(port.Device, TCPScheme)); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".device",
+				Message: fmt.Sprintf("invalid tcp address: %s (use tcp://host:port)", port.Device),
+			})
+		}
+	}
+
+	if port.IsFile() && port.FilePath() == "" {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".device",
+			Message: "file path is required (use file:///path/to/file)",
+		})
+	}
+
+	return errors
+}
+
+func validateFraming(f *FramingConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	if !containsString([]string{"lf", "crlf", "cr", "none"}, f.LineEnding) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".framing.line_ending",
+			Message: fmt.Sprintf("invalid line ending: %s (must be 'lf', 'crlf', 'cr' or 'none')", f.LineEnding),
+		})
+	}
+
+	if !containsString([]string{"utf8", "latin1", "ascii"}, f.Charset) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".framing.charset",
+			Message: fmt.Sprintf("invalid charset: %s (must be 'utf8', 'latin1' or 'ascii')", f.Charset),
+		})
+	}
+
+	if !containsString([]string{"none", "even", "odd", "mark", "space"}, f.ParityBit) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".framing.parity_bit",
+			Message: fmt.Sprintf("invalid parity bit: %s (must be 'none', 'even', 'odd', 'mark' or 'space')", f.ParityBit),
+		})
+	} else if f.ParityBit != "none" && f.Charset != "ascii" {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".framing.parity_bit",
+			Message: "requires the ascii charset",
+		})
+	}
+
+	if f.LineWidth < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".framing.line_width",
+			Message: "must not be negative",
+		})
+	}
+
+	return errors
+}
+
+func validateFaults(f *FaultConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	probabilities := []struct {
+		name  string
+		value float64
+	}{
+		{"truncate", f.Truncate},
+		{"drop_line", f.DropLine},
+		{"duplicate", f.Duplicate},
+		{"garbage", f.Garbage},
+		{"control_bytes", f.ControlBytes},
+		{"bit_flip", f.BitFlip},
+		{"split", f.Split},
+		{"omit_separator", f.OmitSeparator},
+	}
+	for _, p := range probabilities {
+		if p.value < 0 || p.value > 1 {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".faults." + p.name,
+				Message: fmt.Sprintf("probability must be between 0 and 1, got %g", p.value),
+			})
+		}
+	}
+
+	if f.SplitPauseMs < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".faults.split_pause_ms",
+			Message: "must not be negative",
+		})
+	}
+
+	return errors
+}
+
+func validateSchedule(s *ScheduleConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	// Times are resolved as the channel does: stop_at after start_at
+	now := time.Now()
+	start := now
+	if s.StartAt != "" {
+		t, err := ParseScheduleTime(s.StartAt, now)
+		if err != nil {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".schedule.start_at",
+				Message: err.Error(),
+			})
+		} else {
+			start = t
+		}
+	}
+	if s.StopAt != "" {
+		stop, err := ParseScheduleTime(s.StopAt, start)
+		if err != nil {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".schedule.stop_at",
+				Message: err.Error(),
+			})
+		} else if s.StartAt != "" && !stop.After(start) {
+			errors = append(errors, ValidationError{
+				Field:   prefix + ".schedule.stop_at",
+				Message: "must be after start_at",
+			})
+		}
+	}
+
+	for i, w := range s.Windows {
+		wPrefix := fmt.Sprintf("%s.schedule.windows[%d]", prefix, i)
+		for _, day := range w.Days {
+			if _, ok := ScheduleDays[strings.ToLower(day)]; !ok {
+				errors = append(errors, ValidationError{
+					Field:   wPrefix + ".days",
+					Message: fmt.Sprintf("invalid day: %s (must be mon, tue, wed, thu, fri, sat or sun)", day),
+				})
+			}
+		}
+		if _, err := ParseTimeOfDay(w.Start); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   wPrefix + ".start",
+				Message: err.Error(),
+			})
+		}
+		if _, err := ParseTimeOfDay(w.End); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   wPrefix + ".end",
+				Message: err.Error(),
+			})
+		}
+	}
+
+	if s.MaxRecords < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".schedule.max_records",
+			Message: "must not be negative",
+		})
+	}
+	if s.MaxDurationSec < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".schedule.max_duration_sec",
+			Message: "must not be negative",
+		})
+	}
+
+	return errors
+}
+
+func validateReceive(recv *ReceiveConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	if len(recv.AckChar) != 1 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".receive.ack_char",
+			Message: "must be a single byte",
+		})
+	}
+
+	if len(recv.NakChar) != 1 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".receive.nak_char",
+			Message: "must be a single byte",
+		})
+	}
+
+	if recv.AckTimeoutMs < 1 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".receive.ack_timeout_ms",
+			Message: "must be at least 1",
+		})
+	}
+
+	if r := recv.MaxRetransmits; r != nil && *r < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".receive.max_retransmits",
+			Message: "must not be negative",
+		})
+	}
+
+	return errors
+}
+
+func validateHTTP(port PortConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	if u, err := url.Parse(port.Device); err != nil || u.Host == "" {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".device",
+			Message: fmt.Sprintf("invalid webhook URL: %s", port.Device),
+		})
+	}
+
+	if port.HTTP == nil {
+		return errors
+	}
+
+	if !containsString([]string{"raw", "json"}, port.HTTP.Payload) {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".http.payload",
+			Message: fmt.Sprintf("invalid payload: %s (must be 'raw' or 'json')", port.HTTP.Payload),
+		})
+	}
+
+	if port.HTTP.TimeoutSec < 1 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".http.timeout_sec",
+			Message: "must be at least 1 second",
+		})
+	}
+
+	if r := port.HTTP.MaxRetries; r != nil && *r < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".http.max_retries",
+			Message: "must not be negative",
+		})
+	}
+
+	if port.HTTP.BatchSize < 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".http.batch_size",
+			Message: "must not be negative",
+		})
+	}
+
+	// Stream mode counts a call as sent once its last line is written;
+	// it does not wait for queued lines to be posted
+	if port.HTTP.BatchSize > 1 && port.IsStreaming() {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".http.batch_size",
+			Message: "batching is not supported with stream output mode",
+		})
+	}
+
+	return errors
+}
+
 func contains(slice []int, val int) bool {
 	for _, item := range slice {
 		if item == val {
@@ -224,3 +697,91 @@ func containsString(slice []string, val string) bool {
 	}
 	return false
 }
+
+func validateAuth(auth *AuthConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	if len(auth.Tokens) == 0 && len(auth.Users) == 0 {
+		errors = append(errors, ValidationError{
+			Field:   prefix,
+			Message: "needs at least one token or user",
+		})
+	}
+
+	validRole := func(role string) bool {
+		return role == RoleRead || role == RoleAdmin
+	}
+
+	names := make(map[string]bool)
+	for i, t := range auth.Tokens {
+		field := fmt.Sprintf("%s.tokens[%d]", prefix, i)
+		if t.Name == "" {
+			errors = append(errors, ValidationError{Field: field + ".name", Message: "is required"})
+		} else if names[t.Name] {
+			errors = append(errors, ValidationError{Field: field + ".name", Message: fmt.Sprintf("duplicate name: %s", t.Name)})
+		}
+		names[t.Name] = true
+		if len(t.Token) < 16 {
+			errors = append(errors, ValidationError{Field: field + ".token", Message: "must be at least 16 characters"})
+		}
+		if !validRole(t.Role) {
+			errors = append(errors, ValidationError{Field: field + ".role", Message: "must be read or admin"})
+		}
+	}
+
+	users := make(map[string]bool)
+	for i, u := range auth.Users {
+		field := fmt.Sprintf("%s.users[%d]", prefix, i)
+		if u.Username == "" || strings.Contains(u.Username, ":") {
+			errors = append(errors, ValidationError{Field: field + ".username", Message: "is required and must not contain ':'"})
+		} else if users[u.Username] {
+			errors = append(errors, ValidationError{Field: field + ".username", Message: fmt.Sprintf("duplicate username: %s", u.Username)})
+		}
+		users[u.Username] = true
+		if u.Password == "" {
+			errors = append(errors, ValidationError{Field: field + ".password", Message: "is required"})
+		}
+		if !validRole(u.Role) {
+			errors = append(errors, ValidationError{Field: field + ".role", Message: "must be read or admin"})
+		}
+	}
+
+	return errors
+}
+
+func validateTLS(t *TLSConfig, prefix string) ValidationErrors {
+	var errors ValidationErrors
+
+	files := []struct {
+		field    string
+		path     string
+		required bool
+	}{
+		{"cert_file", t.CertFile, true},
+		{"key_file", t.KeyFile, true},
+		{"client_ca_file", t.ClientCAFile, false},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			if f.required {
+				errors = append(errors, ValidationError{Field: prefix + "." + f.field, Message: "is required"})
+			}
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			errors = append(errors, ValidationError{
+				Field:   prefix + "." + f.field,
+				Message: fmt.Sprintf("file not found: %s", f.path),
+			})
+		}
+	}
+
+	if t.AdminClientCert && t.ClientCAFile == "" {
+		errors = append(errors, ValidationError{
+			Field:   prefix + ".admin_client_cert",
+			Message: "requires client_ca_file",
+		})
+	}
+
+	return errors
+}
@@ -0,0 +1,47 @@
+package format
+
+import (
+	"fmt"
+	"time"
+)
+
+// Call dispositions
+const (
+	DispositionAnswered  = "answered"
+	DispositionAbandoned = "abandoned"
+)
+
+// CallParams fixes parts of a generated call. Fields left empty are filled
+// in randomly, as for any synthetic call; fields that are set are used
+// as given, without validation, so malformed values reach the output.
+type CallParams struct {
+	ANI            string        `json:"ani,omitempty"`
+	CallbackNumber string        `json:"callback_number,omitempty"`
+	Location       *Location     `json:"location,omitempty"`
+	Carrier        *Carrier      `json:"carrier,omitempty"`
+	Agent          *Agent        `json:"agent,omitempty"`
+	Disposition    string        `json:"disposition,omitempty"` // "answered" or "abandoned"
+	Duration       time.Duration `json:"-"`
+}
+
+// CallGenerator is implemented by formats that can generate a call with
+// specific parameters
+type CallGenerator interface {
+	GenerateCall(ctx *GenerationContext, params *CallParams) (*CDRRecord, error)
+}
+
+// GenerateCall creates a call record in format f with the given parameters
+func GenerateCall(f CDRFormat, ctx *GenerationContext, params *CallParams) (*CDRRecord, error) {
+	g, ok := f.(CallGenerator)
+	if !ok {
+		return nil, fmt.Errorf("format %s does not support call parameters", f.Name())
+	}
+
+	switch params.Disposition {
+	case "", DispositionAnswered, DispositionAbandoned:
+	default:
+		return nil, fmt.Errorf("unknown disposition: %s", params.Disposition)
+	}
+
+	return g.GenerateCall(ctx, params)
+}
@@ -1,6 +1,8 @@
 package format
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math/rand"
@@ -26,6 +28,19 @@ func (r *CDRRecord) Output() []byte {
 	return output
 }
 
+// ContentHash returns a SHA-256 hash of the record's lines joined with
+// newlines, independent of how they were framed on the wire
+func (r *CDRRecord) ContentHash() string {
+	h := sha256.New()
+	for i, line := range r.Lines {
+		if i > 0 {
+			h.Write([]byte{'\n'})
+		}
+		h.Write([]byte(line))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // GenerationContext provides context for synthetic record generation
 type GenerationContext struct {
 	SystemID     string
@@ -40,28 +55,28 @@ type GenerationContext struct {
 
 // Agent represents a call taker agent
 type Agent struct {
-	ID   string
-	Name string
-	Role string
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
 }
 
 // Location represents a geographic location for ALI data
 type Location struct {
-	Address    string
-	City       string
-	State      string
-	Township   string
-	ESN        string
-	Latitude   float64
-	Longitude  float64
-	Altitude   float64
+	Address    string  `json:"address"`
+	City       string  `json:"city"`
+	State      string  `json:"state"`
+	Township   string  `json:"township"`
+	ESN        string  `json:"esn"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	Altitude   float64 `json:"altitude"`
 }
 
 // Carrier represents a phone carrier
 type Carrier struct {
-	Code     string // e.g., "VZW", "TMOB", "ATTMO"
-	Name     string // e.g., "VERIZON", "T-MOBILE USA, INC."
-	Type     string // e.g., "WPH2" (Wireless Phase 2)
+	Code     string `json:"code"` // e.g., "VZW", "TMOB", "ATTMO"
+	Name     string `json:"name"` // e.g., "VERIZON", "T-MOBILE USA, INC."
+	Type     string `json:"type"` // e.g., "WPH2" (Wireless Phase 2)
 }
 
 // CDRFormat defines the interface that all CDR format handlers must implement.
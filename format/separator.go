@@ -0,0 +1,17 @@
+package format
+
+// RecordSeparator is implemented by formats whose records are delimited by
+// marker lines, such as Vesta's dashed separator or Viper's BEGIN/END
+// banners
+type RecordSeparator interface {
+	IsSeparator(line string) bool
+}
+
+// IsSeparator reports whether line is a record delimiter in format f.
+// Formats that do not implement RecordSeparator have no separator lines.
+func IsSeparator(f CDRFormat, line string) bool {
+	if s, ok := f.(RecordSeparator); ok {
+		return s.IsSeparator(line)
+	}
+	return false
+}
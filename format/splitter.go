@@ -0,0 +1,75 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+)
+
+// ParseLines parses lines read off the wire, in the order they arrived,
+// with the format's sample parser. The lines are laid out as a sample CSV
+// so records are grouped and identified exactly as in replay mode.
+func ParseLines(f CDRFormat, lines []string) ([]CDRRecord, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"sysident", "message"})
+	for i, line := range lines {
+		w.Write([]string{strconv.Itoa(i + 1), line})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return f.ParseRecords(&buf)
+}
+
+// Splitter regroups a stream of received lines into records. Lines are
+// buffered until a separator line closes a record, then parsed with
+// ParseLines.
+type Splitter struct {
+	format CDRFormat
+	lines  []string
+}
+
+// NewSplitter creates a splitter for format f
+func NewSplitter(f CDRFormat) *Splitter {
+	return &Splitter{format: f}
+}
+
+// Add adds a received line. It returns the records the line completes, or
+// nil while a record is still open.
+func (s *Splitter) Add(line string) ([]CDRRecord, error) {
+	s.lines = append(s.lines, line)
+	if !IsSeparator(s.format, line) {
+		return nil, nil
+	}
+
+	records, err := ParseLines(s.format, s.lines)
+	if err != nil {
+		return nil, err
+	}
+
+	// A separator that opens a record (Viper's BEGIN banner) leaves the
+	// last record with nothing after it
+	if len(records) == 0 {
+		return nil, nil
+	}
+	last := records[len(records)-1]
+	if len(last.Lines) < 2 || !IsSeparator(s.format, last.Lines[len(last.Lines)-1]) {
+		return nil, nil
+	}
+
+	s.lines = nil
+	return records, nil
+}
+
+// Flush returns the records in any buffered lines, including a final
+// record that was never closed
+func (s *Splitter) Flush() ([]CDRRecord, error) {
+	if len(s.lines) == 0 {
+		return nil, nil
+	}
+	records, err := ParseLines(s.format, s.lines)
+	s.lines = nil
+	return records, err
+}
@@ -0,0 +1,41 @@
+package format
+
+import "time"
+
+// StreamLine is one output line of a record and when it is printed,
+// relative to the start of the call
+type StreamLine struct {
+	Offset time.Duration
+	Text   string
+}
+
+// EventStreamer is implemented by formats that know when each line of a
+// record is printed during a call. It is used by streaming output mode to
+// emit lines as the events happen instead of one block at end of call.
+type EventStreamer interface {
+	StreamLines(record *CDRRecord) []StreamLine
+}
+
+// StreamLines returns the timed lines for a record. Formats that do not
+// implement EventStreamer print every line at the start of the call.
+// Offsets are clamped so they never go backwards.
+func StreamLines(f CDRFormat, record *CDRRecord) []StreamLine {
+	var lines []StreamLine
+	if streamer, ok := f.(EventStreamer); ok {
+		lines = streamer.StreamLines(record)
+	} else {
+		lines = make([]StreamLine, len(record.Lines))
+		for i, line := range record.Lines {
+			lines[i] = StreamLine{Text: line}
+		}
+	}
+
+	var last time.Duration
+	for i := range lines {
+		if lines[i].Offset < last {
+			lines[i].Offset = last
+		}
+		last = lines[i].Offset
+	}
+	return lines
+}
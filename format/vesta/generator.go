@@ -10,15 +10,36 @@ import (
 
 // GenerateVestaRecord creates a synthetic Vesta CDR record
 func GenerateVestaRecord(ctx *format.GenerationContext) (*format.CDRRecord, error) {
+	return GenerateVestaCall(ctx, &format.CallParams{})
+}
+
+// GenerateVestaCall creates a Vesta CDR record using any call parameters
+// that are set. Vesta records carry no agent, so params.Agent is unused.
+func GenerateVestaCall(ctx *format.GenerationContext, params *format.CallParams) (*format.CDRRecord, error) {
 	callNum := ctx.NextCallNumber()
 	callID := fmt.Sprintf("%d", callNum)
 
+	// Random values are always drawn so a seeded context produces the same
+	// sequence whichever parameters are set
 	ani := ctx.RandomPhoneNumber()
 	cpn := ctx.RandomPhoneNumber()
 	location := ctx.RandomLocation()
 	carrier := ctx.RandomCarrier()
 	_ = ctx.RandomAgent() // Reserved for future agent tracking
 
+	if params.ANI != "" {
+		ani = params.ANI
+	}
+	if params.CallbackNumber != "" {
+		cpn = params.CallbackNumber
+	}
+	if params.Location != nil {
+		location = *params.Location
+	}
+	if params.Carrier != nil {
+		carrier = *params.Carrier
+	}
+
 	now := ctx.CurrentTime
 	if now.IsZero() {
 		now = time.Now()
@@ -26,6 +47,9 @@ func GenerateVestaRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 
 	// Random call duration between 30 seconds and 5 minutes
 	duration := ctx.RandomDuration(30, 300)
+	if params.Duration > 0 {
+		duration = params.Duration
+	}
 	endTime := now.Add(duration)
 
 	// Generate position/device names
@@ -44,21 +68,33 @@ func GenerateVestaRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 	// PSAP identifier line
 	lines = append(lines, fmt.Sprintf("%d %s", 3001, "Nebraska"))
 
-	// Call event line (all events on one line, space-separated)
-	callEvents := fmt.Sprintf("ANI             %s                                                      CPN             %s                                                                                                                                      Call %s   Arrives On               %s     %s %s           Goes Off Hook                            %s %s           Queue In                 %s         %s Call %s   Cellular Call                            %s Call %s   CPN: %s                          %s %s         Queue Out (Answered)     %s           %s %s          Picks Up                                 %s %s     Is Released                              %s %s          Hangs Up                 Call %s   %s %s          Releases                 Call %s   %s Call %s   Finishes                                 %s",
+	// Call event line (all events on one line, space-separated). The call
+	// arrives and queues the same way whether it is answered or abandoned.
+	callEvents := fmt.Sprintf("ANI             %s                                                      CPN             %s                                                                                                                                      Call %s   Arrives On               %s     %s %s           Goes Off Hook                            %s %s           Queue In                 %s         %s Call %s   Cellular Call                            %s Call %s   CPN: %s                          %s %s         Queue Out (",
 		ani, cpn,
 		callID, eimDevice, now.Format(dateFormat),
 		eimDevice, now.Format(dateFormat),
 		eimDevice, queueName, now.Format(dateFormat),
 		callID, now.Add(2*time.Second).Format(dateFormat),
 		callID, cpn, now.Add(2*time.Second).Format(dateFormat),
-		queueName, posDevice, now.Add(4*time.Second).Format(dateFormat),
-		posDevice, now.Add(4*time.Second).Format(dateFormat),
-		eimDevice, endTime.Format(dateFormat),
-		posDevice, callID, endTime.Format(dateFormat),
-		posDevice, callID, endTime.Format(dateFormat),
-		callID, endTime.Format(dateFormat),
+		queueName,
 	)
+	if params.Disposition == format.DispositionAbandoned {
+		callEvents += fmt.Sprintf("Abandoned)                    %s %s     Is Released                              %s Call %s   Finishes                                 %s",
+			endTime.Format(dateFormat),
+			eimDevice, endTime.Format(dateFormat),
+			callID, endTime.Format(dateFormat),
+		)
+	} else {
+		callEvents += fmt.Sprintf("Answered)     %s           %s %s          Picks Up                                 %s %s     Is Released                              %s %s          Hangs Up                 Call %s   %s %s          Releases                 Call %s   %s Call %s   Finishes                                 %s",
+			posDevice, now.Add(4*time.Second).Format(dateFormat),
+			posDevice, now.Add(4*time.Second).Format(dateFormat),
+			eimDevice, endTime.Format(dateFormat),
+			posDevice, callID, endTime.Format(dateFormat),
+			posDevice, callID, endTime.Format(dateFormat),
+			callID, endTime.Format(dateFormat),
+		)
+	}
 	lines = append(lines, callEvents)
 
 	// ALI Information marker
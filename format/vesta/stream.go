@@ -0,0 +1,71 @@
+package vesta
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"cdrgenerator/format"
+)
+
+// vestaLineGap separates printer lines that were concatenated into one
+// message with their trailing padding. Event lines never contain a gap
+// this long.
+var vestaLineGap = regexp.MustCompile(`\s{40,}`)
+
+// vestaEventTime matches the timestamp that ends each event line,
+// e.g. "Dec/01/25 15:55:58 EST"
+var vestaEventTime = regexp.MustCompile(`[A-Z][a-z]{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} [A-Z]{3}`)
+
+const vestaEventTimeLayout = "Jan/02/06 15:04:05 MST"
+
+// StreamLines splits a Vesta record into printer lines, timing
+// each event line from its own timestamp. Lines without a timestamp are
+// printed with the event before them.
+func (f *VestaFormat) StreamLines(record *format.CDRRecord) []format.StreamLine {
+	var lines []format.StreamLine
+	var start time.Time
+	var offset time.Duration
+
+	for _, message := range record.Lines {
+		for _, text := range splitPrinterLines(message) {
+			if match := vestaEventTime.FindString(text); match != "" {
+				if ts, err := time.Parse(vestaEventTimeLayout, match); err == nil {
+					if start.IsZero() {
+						start = ts
+					}
+					offset = ts.Sub(start)
+				}
+			}
+			lines = append(lines, format.StreamLine{Offset: offset, Text: text})
+		}
+	}
+
+	return lines
+}
+
+// splitPrinterLines breaks a concatenated message back into printer lines.
+// Each event line ends with its timestamp; other lines are separated by
+// their padding.
+func splitPrinterLines(message string) []string {
+	var segments []string
+	pos := 0
+	for _, loc := range vestaEventTime.FindAllStringIndex(message, -1) {
+		segments = append(segments, message[pos:loc[1]])
+		pos = loc[1]
+	}
+	segments = append(segments, message[pos:])
+
+	var lines []string
+	for _, segment := range segments {
+		for _, text := range vestaLineGap.Split(segment, -1) {
+			if text = strings.TrimSpace(text); text != "" {
+				lines = append(lines, text)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return []string{message}
+	}
+	return lines
+}
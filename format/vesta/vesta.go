@@ -31,3 +31,13 @@ func (f *VestaFormat) ParseRecords(reader io.Reader) ([]format.CDRRecord, error)
 func (f *VestaFormat) GenerateRecord(ctx *format.GenerationContext) (*format.CDRRecord, error) {
 	return GenerateVestaRecord(ctx)
 }
+
+// GenerateCall creates a Vesta CDR record with specific call parameters
+func (f *VestaFormat) GenerateCall(ctx *format.GenerationContext, params *format.CallParams) (*format.CDRRecord, error) {
+	return GenerateVestaCall(ctx, params)
+}
+
+// IsSeparator reports whether line is the dashed line between records
+func (f *VestaFormat) IsSeparator(line string) bool {
+	return line == VestaSeparator
+}
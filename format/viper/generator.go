@@ -10,13 +10,35 @@ import (
 
 // GenerateViperRecord creates a synthetic Viper CDR record
 func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, error) {
+	return GenerateViperCall(ctx, &format.CallParams{})
+}
+
+// GenerateViperCall creates a Viper CDR record using any call parameters
+// that are set. Viper records show only the ANI, so params.CallbackNumber
+// is unused.
+func GenerateViperCall(ctx *format.GenerationContext, params *format.CallParams) (*format.CDRRecord, error) {
 	callNum := ctx.NextCallNumber()
 
+	// Random values are always drawn so a seeded context produces the same
+	// sequence whichever parameters are set
 	ani := ctx.RandomPhoneNumber()
 	location := ctx.RandomLocation()
 	carrier := ctx.RandomCarrier()
 	agent := ctx.RandomAgent()
 
+	if params.ANI != "" {
+		ani = params.ANI
+	}
+	if params.Location != nil {
+		location = *params.Location
+	}
+	if params.Carrier != nil {
+		carrier = *params.Carrier
+	}
+	if params.Agent != nil {
+		agent = *params.Agent
+	}
+
 	now := ctx.CurrentTime
 	if now.IsZero() {
 		now = time.Now()
@@ -24,6 +46,9 @@ func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 
 	// Random call duration between 30 seconds and 5 minutes
 	duration := ctx.RandomDuration(30, 300)
+	if params.Duration > 0 {
+		duration = params.Duration
+	}
 
 	// Generate trunk and call IDs
 	trunkNum := ctx.Random.Intn(10) + 1
@@ -50,7 +75,7 @@ func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 	// System ID and trunk info
 	lines = append(lines, fmt.Sprintf("00:00:00.000 [  TS] SYSTEM ID = %s", strings.ToLower(ctx.SystemID)))
 	lines = append(lines, fmt.Sprintf("00:00:00.000 [VoIP] Incoming Call(ID: %s) Offered on Trunk %s/%s-%s",
-		callID, trunkName, ani[:10], trunkName))
+		callID, trunkName, ani[:min(10, len(ani))], trunkName))
 	lines = append(lines, fmt.Sprintf("00:00:00.000 [  TS] Trunk Group = %s", trunkGroup))
 	lines = append(lines, "00:00:00.000 [VoIP] Call Presented")
 	lines = append(lines, fmt.Sprintf("00:00:00.000 [VoIP] ANI: (40)'%s' [VALID] PseudoANI: '' [NONE]", ani))
@@ -70,7 +95,11 @@ func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 	// Call terminated
 	durationMs := duration.Milliseconds()
 	durationStr := formatDuration(duration)
-	lines = append(lines, fmt.Sprintf("%s [VoIP] Caller Disconnected Before Supervision", durationStr))
+	if params.Disposition == format.DispositionAnswered {
+		lines = append(lines, fmt.Sprintf("%s [VoIP] Caller Disconnected", durationStr))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s [VoIP] Caller Disconnected Before Supervision", durationStr))
+	}
 	lines = append(lines, fmt.Sprintf("%s [VoIP] Call Terminated", formatDuration(duration+73*time.Millisecond)))
 	lines = append(lines, fmt.Sprintf("%s [  TS] Call Completed", formatDuration(duration+73*time.Millisecond)))
 
@@ -93,7 +122,8 @@ func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 		carrier.Code, ctx.Random.Intn(50)+1, posNum, carrier.Type))
 	lines = append(lines, "                                ")
 	lines = append(lines, "      ")
-	lines = append(lines, fmt.Sprintf("P#(%s)%s", ani[:3], ani[3:]))
+	split := min(3, len(ani))
+	lines = append(lines, fmt.Sprintf("P#(%s)%s", ani[:split], ani[split:]))
 
 	// Location confidence
 	accuracy := 4.64 + ctx.Random.Float64()*50
@@ -106,8 +136,16 @@ func GenerateViperRecord(ctx *format.GenerationContext) (*format.CDRRecord, erro
 	// CDR END marker
 	lines = append(lines, ViperCDREnd)
 
-	// Optionally add AGENT block
-	if ctx.Random.Float32() > 0.3 { // 70% chance of agent event
+	// Optionally add AGENT block; answered calls always have one and
+	// abandoned calls never do
+	withAgent := ctx.Random.Float32() > 0.3 // 70% chance of agent event
+	switch params.Disposition {
+	case format.DispositionAnswered:
+		withAgent = true
+	case format.DispositionAbandoned:
+		withAgent = false
+	}
+	if withAgent {
 		lines = append(lines, "")
 		agentLines := generateAgentBlock(ctx, agent, callID, posNum, stnNum, now)
 		lines = append(lines, agentLines...)
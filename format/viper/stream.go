@@ -0,0 +1,37 @@
+package viper
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"cdrgenerator/format"
+)
+
+// viperEventOffset matches the elapsed-time prefix of Viper event lines,
+// e.g. "00:00:01.696 [ PAS] Initial ALI Response received"
+var viperEventOffset = regexp.MustCompile(`^(\d{2}):(\d{2}):(\d{2})\.(\d{3}) `)
+
+// StreamLines times each Viper line from its elapsed-time prefix. Lines
+// without a prefix (markers, the ALI block, agent blocks) are printed with
+// the event before them.
+func (f *ViperFormat) StreamLines(record *format.CDRRecord) []format.StreamLine {
+	lines := make([]format.StreamLine, len(record.Lines))
+	var offset time.Duration
+
+	for i, text := range record.Lines {
+		if m := viperEventOffset.FindStringSubmatch(text); m != nil {
+			h, _ := strconv.Atoi(m[1])
+			mins, _ := strconv.Atoi(m[2])
+			sec, _ := strconv.Atoi(m[3])
+			ms, _ := strconv.Atoi(m[4])
+			offset = time.Duration(h)*time.Hour +
+				time.Duration(mins)*time.Minute +
+				time.Duration(sec)*time.Second +
+				time.Duration(ms)*time.Millisecond
+		}
+		lines[i] = format.StreamLine{Offset: offset, Text: text}
+	}
+
+	return lines
+}
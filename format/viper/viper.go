@@ -3,6 +3,7 @@ package viper
 import (
 	"cdrgenerator/format"
 	"io"
+	"strings"
 )
 
 func init() {
@@ -31,3 +32,16 @@ func (f *ViperFormat) ParseRecords(reader io.Reader) ([]format.CDRRecord, error)
 func (f *ViperFormat) GenerateRecord(ctx *format.GenerationContext) (*format.CDRRecord, error) {
 	return GenerateViperRecord(ctx)
 }
+
+// GenerateCall creates a Viper CDR record with specific call parameters
+func (f *ViperFormat) GenerateCall(ctx *format.GenerationContext, params *format.CallParams) (*format.CDRRecord, error) {
+	return GenerateViperCall(ctx, params)
+}
+
+// IsSeparator reports whether line is a CDR or agent BEGIN/END banner
+func (f *ViperFormat) IsSeparator(line string) bool {
+	return strings.HasPrefix(line, ViperCDRBegin) ||
+		strings.HasPrefix(line, ViperCDREnd) ||
+		strings.HasPrefix(line, ViperAgentBegin) ||
+		strings.HasPrefix(line, ViperAgentEnd)
+}
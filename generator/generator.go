@@ -2,14 +2,20 @@ package generator
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	"cdrgenerator/config"
 	"cdrgenerator/format"
 )
 
+// ErrSampleEnd is returned by a replay generator that has sent every record
+// in its sample file and does not loop
+var ErrSampleEnd = errors.New("end of sample file reached")
+
 // Mode represents the generator mode
 type Mode string
 
@@ -29,8 +35,21 @@ type Generator struct {
 	// For replay mode
 	records      []format.CDRRecord
 	recordIndex  int
+	loops        int
 	loop         bool
-	recordsMutex sync.Mutex
+	recordsMutex sync.Mutex // Also guards genContext
+}
+
+// State is the position of a generator in its sequence of records, saved
+// so a restarted generator carries on where it left off
+type State struct {
+	Format        string `json:"format"`
+	Mode          Mode   `json:"mode"`
+	SampleFile    string `json:"sample_file,omitempty"`
+	ReplayIndex   int    `json:"replay_index"`
+	ReplayRecords int    `json:"replay_records,omitempty"` // Sample file size, to notice a shrunk file
+	Loops         int    `json:"loops"`
+	CallNumber    int    `json:"call_number"`
 }
 
 // New creates a new generator for the given port configuration
@@ -59,16 +78,17 @@ func New(portCfg *config.PortConfig, jitterPercent float64) (*Generator, error)
 		if err := g.loadSampleFile(); err != nil {
 			return nil, err
 		}
-	} else {
-		// Synthetic mode - create generation context
-		systemID := "default"
-		psapName := "Default PSAP"
-		if portCfg.Synthetic != nil {
-			systemID = portCfg.Synthetic.SystemID
-		}
-		g.genContext = format.NewGenerationContext(systemID, psapName, 0)
 	}
 
+	// Create generation context, also used in replay mode for calls
+	// generated on request
+	systemID := "default"
+	psapName := "Default PSAP"
+	if portCfg.Synthetic != nil {
+		systemID = portCfg.Synthetic.SystemID
+	}
+	g.genContext = format.NewGenerationContext(systemID, psapName, 0)
+
 	return g, nil
 }
 
@@ -114,17 +134,17 @@ func (g *Generator) nextReplayRecord() (*format.CDRRecord, error) {
 	if len(g.records) == 0 {
 		return nil, fmt.Errorf("no records available")
 	}
+	if g.recordIndex >= len(g.records) {
+		return nil, ErrSampleEnd
+	}
 
 	record := g.records[g.recordIndex]
 	g.recordIndex++
 
 	// Handle looping
-	if g.recordIndex >= len(g.records) {
-		if g.loop {
-			g.recordIndex = 0
-		} else {
-			return nil, fmt.Errorf("end of sample file reached")
-		}
+	if g.recordIndex >= len(g.records) && g.loop {
+		g.recordIndex = 0
+		g.loops++
 	}
 
 	return &record, nil
@@ -136,9 +156,69 @@ func (g *Generator) nextSyntheticRecord() (*format.CDRRecord, error) {
 		return nil, fmt.Errorf("generation context not initialized")
 	}
 
+	g.recordsMutex.Lock()
+	defer g.recordsMutex.Unlock()
+
 	return g.format.GenerateRecord(g.genContext)
 }
 
+// GenerateCall creates a call record with specific parameters, outside the
+// normal sequence of records
+func (g *Generator) GenerateCall(params *format.CallParams) (*format.CDRRecord, error) {
+	g.recordsMutex.Lock()
+	defer g.recordsMutex.Unlock()
+
+	// Stamp the call with the time it is sent, leaving the context's time
+	// as it was for the records that follow
+	saved := g.genContext.CurrentTime
+	g.genContext.CurrentTime = time.Now()
+	defer func() { g.genContext.CurrentTime = saved }()
+
+	return format.GenerateCall(g.format, g.genContext, params)
+}
+
+// State returns the generator's current position
+func (g *Generator) State() State {
+	g.recordsMutex.Lock()
+	defer g.recordsMutex.Unlock()
+
+	return State{
+		Format:        g.format.Name(),
+		Mode:          g.mode,
+		SampleFile:    g.portConfig.SampleFile,
+		ReplayIndex:   g.recordIndex,
+		ReplayRecords: len(g.records),
+		Loops:         g.loops,
+		CallNumber:    g.genContext.CallNumber,
+	}
+}
+
+// Restore moves the generator to a saved position. It fails if the state
+// was saved by a generator with a different format, mode or sample file.
+func (g *Generator) Restore(state State) error {
+	if state.Format != g.format.Name() || state.Mode != g.mode || state.SampleFile != g.portConfig.SampleFile {
+		return fmt.Errorf("saved state is for %s %s %s",
+			state.Format, state.Mode, state.SampleFile)
+	}
+
+	g.recordsMutex.Lock()
+	defer g.recordsMutex.Unlock()
+
+	if g.mode == ModeReplay {
+		// An index at the end of the records is a replay without loop that
+		// has finished, and stays finished. The sample file may have shrunk
+		// since the state was saved, in which case the replay starts over.
+		if state.ReplayIndex > len(g.records) || state.ReplayRecords > len(g.records) ||
+			(state.ReplayIndex == len(g.records) && g.loop) {
+			state.ReplayIndex = 0
+		}
+		g.recordIndex = state.ReplayIndex
+		g.loops = state.Loops
+	}
+	g.genContext.CallNumber = state.CallNumber
+	return nil
+}
+
 // RateLimiter returns the rate limiter for this generator
 func (g *Generator) RateLimiter() *RateLimiter {
 	return g.rateLimiter
@@ -2,14 +2,20 @@ package generator
 
 import (
 	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// RateLimiter controls the rate of CDR generation with optional jitter
+// RateLimiter controls the rate of CDR generation with optional jitter.
+// It is safe for concurrent use, so the rate can be changed while a
+// Ticker is running.
 type RateLimiter struct {
+	mu             sync.Mutex
 	callsPerMinute float64
 	jitterPercent  float64
 	random         *rand.Rand
+	changed        chan struct{}
 }
 
 // NewRateLimiter creates a new rate limiter
@@ -18,11 +24,15 @@ func NewRateLimiter(callsPerMinute float64, jitterPercent float64) *RateLimiter
 		callsPerMinute: callsPerMinute,
 		jitterPercent:  jitterPercent,
 		random:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		changed:        make(chan struct{}, 1),
 	}
 }
 
 // NextInterval returns the duration to wait before the next CDR
 func (r *RateLimiter) NextInterval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if r.callsPerMinute <= 0 {
 		return time.Minute // Default to 1 per minute if not set
 	}
@@ -43,12 +53,41 @@ func (r *RateLimiter) NextInterval() time.Duration {
 
 // SetCallsPerMinute updates the rate
 func (r *RateLimiter) SetCallsPerMinute(cpm float64) {
+	r.mu.Lock()
 	r.callsPerMinute = cpm
+	r.mu.Unlock()
+	r.notify()
 }
 
 // SetJitterPercent updates the jitter percentage
 func (r *RateLimiter) SetJitterPercent(jp float64) {
+	r.mu.Lock()
 	r.jitterPercent = jp
+	r.mu.Unlock()
+	r.notify()
+}
+
+// CallsPerMinute returns the current rate
+func (r *RateLimiter) CallsPerMinute() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.callsPerMinute
+}
+
+// JitterPercent returns the current jitter percentage
+func (r *RateLimiter) JitterPercent() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.jitterPercent
+}
+
+// notify wakes a running Ticker so a new rate takes effect immediately
+// rather than after the interval already being waited out
+func (r *RateLimiter) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
 }
 
 // Ticker creates a channel that sends at the configured rate with jitter
@@ -56,6 +95,7 @@ type Ticker struct {
 	limiter *RateLimiter
 	C       chan time.Time
 	done    chan struct{}
+	skipped atomic.Int64
 }
 
 // NewTicker creates a new ticker that fires at the rate limiter's interval
@@ -78,13 +118,22 @@ func (t *Ticker) run() {
 			case t.C <- time.Now():
 			default:
 				// Channel full, skip this tick
+				t.skipped.Add(1)
 			}
+		case <-t.limiter.changed:
+			// Rate changed, start a new interval
 		case <-t.done:
 			return
 		}
 	}
 }
 
+// Skipped returns the number of ticks dropped because the previous one had
+// not been received yet
+func (t *Ticker) Skipped() int64 {
+	return t.skipped.Load()
+}
+
 // Stop stops the ticker
 func (t *Ticker) Stop() {
 	close(t.done)
@@ -8,9 +8,12 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
+	"cdrgenerator/audit"
 	"cdrgenerator/config"
 	"cdrgenerator/format"
 	"cdrgenerator/monitoring"
@@ -38,6 +41,11 @@ func main() {
 	listFormats := flag.Bool("list-formats", false, "List registered CDR formats and exit")
 	debug := flag.Bool("debug", false, "Enable debug logging")
 	showVersion := flag.Bool("version", false, "Display version information")
+	exportLedger := flag.Bool("export-ledger", false, "Write the sent-record ledger to stdout as JSONL and exit")
+	preview := flag.Int("preview", 0, "Write the next N records the port given by -device would send to stdout and exit, without opening it")
+	ledgerDevice := flag.String("device", "", "With -export-ledger: only this device; with -preview: the port to preview")
+	ledgerFrom := flag.String("from", "", "With -export-ledger: only records sent at or after this RFC 3339 time")
+	ledgerTo := flag.String("to", "", "With -export-ledger: only records sent before this RFC 3339 time")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "CDRGenerator - 911 CDR Traffic Simulator\n\n")
@@ -48,6 +56,8 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -config config.json\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -config config.json -validate\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -list-formats\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -config config.json -export-ledger -from 2025-01-01T00:00:00Z > sent.jsonl\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -config config.json -preview 5 -device /dev/ttyS0\n", os.Args[0])
 	}
 
 	flag.Parse()
@@ -124,6 +134,24 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Handle export-ledger flag
+	if *exportLedger {
+		if err := runLedgerExport(cfg, *ledgerDevice, *ledgerFrom, *ledgerTo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting ledger: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Handle preview flag
+	if *preview > 0 {
+		if err := runPreview(cfg, *ledgerDevice, *preview); err != nil {
+			fmt.Fprintf(os.Stderr, "Error previewing records: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Setup logging
 	logger := setupLogging(cfg, *debug)
 	slog.SetDefault(logger)
@@ -142,24 +170,85 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// The first reason to stop wins; it is read once ctx is done
+	stopReason := make(chan string, 1)
+	stop := func(reason string) {
+		select {
+		case stopReason <- reason:
+		default:
+		}
+		cancel()
+	}
 	go func() {
 		sig := <-sigChan
 		logger.Info("Received shutdown signal", "signal", sig)
-		cancel()
+		stop("signal " + sig.String())
 	}()
 
+	// Audit log of changes, from the API and from the service itself
+	auditLog, err := audit.Open(cfg.App.AuditLog, logger)
+	if err != nil {
+		logger.Error("Failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	defer auditLog.Close()
+
 	// Create Slack notifier
 	slackNotifier := notify.NewSlackNotifier(&cfg.Slack, cfg.App.InstanceID, logger)
 
 	// Create and start output manager
 	outputMgr := output.NewManager(cfg, logger)
+	auditLog.FollowChannels(outputMgr.Events())
 	if err := outputMgr.Start(ctx); err != nil {
 		logger.Error("Failed to start output manager", "error", err)
 		os.Exit(1)
 	}
+	auditLog.Record(audit.Entry{
+		Actor:  audit.SystemActor,
+		Action: audit.ActionServiceStart,
+		After: map[string]interface{}{
+			"version":  version,
+			"config":   *configPath,
+			"channels": outputMgr.ChannelCount(),
+		},
+	})
+
+	// Reload applies changes in the config file to the running channels
+	var reloadMu sync.Mutex
+	reloadConfig := func() (*output.ReloadResult, error) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		newCfg, err := config.Load(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.Validate(newCfg, format.List()); err != nil {
+			return nil, err
+		}
+		return outputMgr.ApplyConfig(newCfg)
+	}
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	hupReload := auditReload(reloadConfig, auditLog, "SIGHUP")
+	go func() {
+		for range hupChan {
+			logger.Info("Received SIGHUP, reloading configuration", "path", *configPath)
+			if _, err := hupReload(); err != nil {
+				logger.Error("Configuration reload failed", "error", err)
+			}
+		}
+	}()
+
+	if cfg.App.WatchConfig {
+		go watchConfig(ctx, *configPath, auditReload(reloadConfig, auditLog, "config file changed"), logger)
+	}
 
 	// Start monitoring server
-	monitorServer := monitoring.NewServer(&cfg.Monitoring, cfg.App.InstanceID, version, outputMgr, logger)
+	monitorServer := monitoring.NewServerWithConfigPath(&cfg.Monitoring, cfg.App.InstanceID, version, outputMgr, logger, *configPath)
+	monitorServer.SetReloader(reloadConfig)
+	monitorServer.SetAuditLog(auditLog)
 	if err := monitorServer.Start(); err != nil {
 		logger.Error("Failed to start monitoring server", "error", err)
 	}
@@ -175,8 +264,24 @@ func main() {
 		"monitoring_port", cfg.Monitoring.Port,
 	)
 
+	// Exit once every scheduled run has finished
+	const reasonFinished = "schedules finished"
+	if cfg.App.ExitWhenFinished {
+		go func() {
+			if outputMgr.WaitFinished(ctx) {
+				logger.Info("All channels finished their schedules")
+				stop(reasonFinished)
+			}
+		}()
+	}
+
 	// Wait for shutdown
 	<-ctx.Done()
+	reason := "shutdown"
+	select {
+	case reason = <-stopReason:
+	default:
+	}
 
 	// Graceful shutdown
 	logger.Info("CDRGenerator shutting down")
@@ -207,6 +312,154 @@ func main() {
 		"uptime", uptime,
 		"total_records", totalRecords,
 	)
+	auditLog.Record(audit.Entry{
+		Actor:  audit.SystemActor,
+		Action: audit.ActionServiceStop,
+		Detail: reason,
+		After: map[string]interface{}{
+			"uptime_sec":    int64(uptime.Seconds()),
+			"total_records": totalRecords,
+		},
+	})
+
+	if reason == reasonFinished {
+		printRunSummary(outputMgr.GetChannelStates(), uptime)
+	}
+}
+
+// printRunSummary writes the results of a finished scheduled run to stdout
+func printRunSummary(states map[string]output.ChannelInfo, uptime time.Duration) {
+	devices := make([]string, 0, len(states))
+	for device := range states {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	fmt.Printf("Run finished after %s\n", uptime.Round(time.Second))
+	for _, device := range devices {
+		info := states[device]
+		fmt.Printf("  %-20s %8d records %10d bytes %5d errors  %s\n",
+			device, info.RecordsSent, info.BytesSent, info.Errors, info.State)
+	}
+}
+
+// runLedgerExport writes ledger entries to stdout for -export-ledger
+func runLedgerExport(cfg *config.Config, device, fromValue, toValue string) error {
+	if cfg.App.LedgerDir == "" {
+		return output.ErrLedgerDisabled
+	}
+
+	var from, to time.Time
+	var err error
+	if fromValue != "" {
+		if from, err = time.Parse(time.RFC3339, fromValue); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if toValue != "" {
+		if to, err = time.Parse(time.RFC3339, toValue); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	n, err := output.ExportLedger(cfg.App.LedgerDir, device, from, to, os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d ledger entries\n", n)
+	return nil
+}
+
+// runPreview writes the records a port would send to stdout for -preview,
+// exactly as they would be written to the port, and describes each one on
+// stderr. With a single port, device may be left empty.
+func runPreview(cfg *config.Config, device string, count int) error {
+	var port *config.PortConfig
+	for i := range cfg.Ports {
+		if cfg.Ports[i].Device == device || (device == "" && len(cfg.Ports) == 1) {
+			port = &cfg.Ports[i]
+		}
+	}
+	if port == nil {
+		if device == "" {
+			return fmt.Errorf("-device is required when the config has more than one port")
+		}
+		return fmt.Errorf("no port for device %s", device)
+	}
+
+	records, err := output.Preview(port, count, cfg.App.StateFile)
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		fmt.Fprintf(os.Stderr, "Record %d: %s %s, %d lines, %d bytes\n",
+			i+1, record.Type, record.RecordID, len(record.Lines), record.Bytes)
+		os.Stdout.WriteString(record.Data)
+	}
+	if len(records) < count {
+		fmt.Fprintf(os.Stderr, "Sample file ended after %d records\n", len(records))
+	}
+	return nil
+}
+
+// auditReload wraps reload so reloads that do not come through the API,
+// such as SIGHUP, are recorded in the audit log too
+func auditReload(reload monitoring.ReloadFunc, auditLog *audit.Log, source string) monitoring.ReloadFunc {
+	return func() (*output.ReloadResult, error) {
+		result, err := reload()
+		entry := audit.Entry{
+			Actor:  audit.SystemActor,
+			Action: audit.ActionConfigReload,
+			Detail: source,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.After = result
+		}
+		auditLog.Record(entry)
+		return result, err
+	}
+}
+
+// configWatchInterval is how often the config file is checked for changes
+const configWatchInterval = 5 * time.Second
+
+// watchConfig reloads the configuration whenever the file's modification
+// time or size changes
+func watchConfig(ctx context.Context, path string, reload monitoring.ReloadFunc, logger *slog.Logger) {
+	info, err := os.Stat(path)
+	if err != nil {
+		logger.Warn("Cannot watch config file", "path", path, "error", err)
+		return
+	}
+	modTime, size := info.ModTime(), info.Size()
+
+	logger.Info("Watching config file for changes", "path", path)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+
+			logger.Info("Config file changed, reloading", "path", path)
+			if _, err := reload(); err != nil {
+				logger.Error("Configuration reload failed", "error", err)
+			}
+		}
+	}
 }
 
 func setupLogging(cfg *config.Config, debug bool) *slog.Logger {
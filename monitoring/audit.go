@@ -0,0 +1,177 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cdrgenerator/audit"
+	"cdrgenerator/config"
+)
+
+// auditRecord collects what a handler changed, for the audit entry of its
+// request
+type auditRecord struct {
+	before, after interface{}
+	detail        string
+}
+
+type auditKey struct{}
+
+// auditChange records the values before and after the change a request
+// made. It does nothing for requests that are not audited.
+func auditChange(r *http.Request, before, after interface{}) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		rec.before, rec.after = before, after
+	}
+}
+
+// auditDetail adds a description of the change a request made
+func auditDetail(r *http.Request, detail string) {
+	if rec, ok := r.Context().Value(auditKey{}).(*auditRecord); ok {
+		rec.detail = detail
+	}
+}
+
+// auditor records every request that needs the admin role in the audit
+// log, with the actor, the outcome and what the handler reports it changed.
+// Requests that only read, such as a preview, need the read role and are
+// not recorded.
+type auditor struct {
+	log *audit.Log // nil until set; nothing is recorded
+}
+
+// wrap audits the requests to next. It runs after authentication, so the
+// actor is known.
+func (a *auditor) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.log == nil || requiredRole(r) != config.RoleAdmin {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &auditRecord{}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)))
+
+		actor := ActorFrom(r.Context())
+		entry := audit.Entry{
+			Actor:  actor.Name,
+			Role:   actor.Role,
+			Addr:   actor.Addr,
+			Action: apiAction(r),
+			Device: r.URL.Query().Get("device"),
+			Before: rec.before,
+			After:  rec.after,
+			Detail: rec.detail,
+		}
+		if sw.status >= http.StatusBadRequest {
+			entry.Error = strings.TrimSpace(sw.errorText.String())
+			if entry.Error == "" {
+				entry.Error = http.StatusText(sw.status)
+			}
+		}
+		a.log.Record(entry)
+	})
+}
+
+// apiAction names the action of a request after its path:
+// POST /api/control/pause is "control.pause"
+func apiAction(r *http.Request) string {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	switch path {
+	case "config":
+		return "config.save"
+	case "config/history/rollback":
+		return "config.rollback"
+	}
+	return strings.ReplaceAll(path, "/", ".")
+}
+
+// errorTextLimit caps how much of an error response is kept for the log
+const errorTextLimit = 500
+
+// statusWriter remembers the status of a response, and the start of its
+// body if it is an error
+type statusWriter struct {
+	http.ResponseWriter
+	status    int
+	errorText strings.Builder
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status >= http.StatusBadRequest && w.errorText.Len() < errorTextLimit {
+		w.errorText.Write(b[:min(len(b), errorTextLimit-w.errorText.Len())])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AuditHandler serves the audit log
+type AuditHandler struct {
+	auditor *auditor
+}
+
+// ServeHTTP returns audit entries, newest first:
+// GET /api/audit?actor=ops&action=control&device=X&from=...&to=...&limit=100
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.auditor.log == nil {
+		http.Error(w, "Audit log not available", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	q := audit.Query{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Device: query.Get("device"),
+		Limit:  100,
+	}
+	var err error
+	if q.From, err = parseTimeParam(query.Get("from")); err != nil {
+		http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if q.To, err = parseTimeParam(query.Get("to")); err != nil {
+		http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Searching a long audit file can outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	entries, err := h.auditor.log.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
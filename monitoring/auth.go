@@ -0,0 +1,172 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"cdrgenerator/config"
+)
+
+// Actor is the caller behind an API request
+type Actor struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Addr string `json:"addr"` // Remote address of the request
+}
+
+type actorKey struct{}
+
+// ActorFrom returns the actor authenticated for the request context. A
+// request that carried no credentials has the actor "anonymous".
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{Name: "anonymous"}
+}
+
+// withActor returns ctx carrying actor
+func withActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// authenticator checks API credentials and the role each request needs.
+// Requests that only read need the read role: safe methods (GET, HEAD,
+// OPTIONS) and POST /api/preview. Anything that changes state needs admin.
+type authenticator struct {
+	auth   *config.AuthConfig // nil when the API is open
+	logger *slog.Logger
+
+	// Admin requests must also present a verified TLS client certificate
+	adminClientCert bool
+}
+
+func newAuthenticator(auth *config.AuthConfig, logger *slog.Logger) *authenticator {
+	return &authenticator{auth: auth, logger: logger}
+}
+
+// wrap enforces authentication on every request to next
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := a.authenticate(r)
+		if !ok {
+			a.logger.Warn("API authentication failed", "addr", r.RemoteAddr, "path", r.URL.Path)
+			a.challenge(w)
+			return
+		}
+		if !allows(actor.Role, requiredRole(r)) {
+			if actor.Role == "" {
+				a.challenge(w)
+				return
+			}
+			a.logger.Warn("API request forbidden",
+				"actor", actor.Name, "role", actor.Role, "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "Forbidden: admin role required", http.StatusForbidden)
+			return
+		}
+		if a.adminClientCert && requiredRole(r) == config.RoleAdmin && !hasClientCert(r) {
+			a.logger.Warn("API request without client certificate",
+				"actor", actor.Name, "method", r.Method, "path", r.URL.Path)
+			http.Error(w, "Forbidden: client certificate required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withActor(r.Context(), actor)))
+	})
+}
+
+// authenticate identifies the caller. It returns false if the request
+// carries credentials that are not valid.
+func (a *authenticator) authenticate(r *http.Request) (Actor, bool) {
+	actor := Actor{Name: "anonymous", Addr: r.RemoteAddr}
+	if hasClientCert(r) {
+		actor.Name = "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+
+	// Without auth configured everyone is an admin
+	if a.auth == nil {
+		actor.Role = config.RoleAdmin
+		return actor, true
+	}
+
+	if token, ok := bearerToken(r); ok {
+		for _, t := range a.auth.Tokens {
+			if secretEqual(token, t.Token) {
+				actor.Name, actor.Role = t.Name, t.Role
+				return actor, true
+			}
+		}
+		return actor, false
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		for _, u := range a.auth.Users {
+			if secretEqual(username, u.Username) && secretEqual(password, u.Password) {
+				actor.Name, actor.Role = u.Username, u.Role
+				return actor, true
+			}
+		}
+		return actor, false
+	}
+
+	if a.auth.AnonymousRead {
+		actor.Role = config.RoleRead
+	}
+	return actor, true
+}
+
+// hasClientCert reports whether the request came with a client
+// certificate that verified against the configured CAs
+func hasClientCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// challenge asks for credentials. Browsers show a login prompt for the
+// dashboard when basic auth users are configured.
+func (a *authenticator) challenge(w http.ResponseWriter) {
+	if a.auth != nil && len(a.auth.Users) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="PollenPusher"`)
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// requiredRole returns the role needed for the request. A preview is
+// posted only to carry the port config to render, and changes nothing.
+func requiredRole(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodGet, r.Method == http.MethodHead, r.Method == http.MethodOptions:
+		return config.RoleRead
+	case r.Method == http.MethodPost && r.URL.Path == "/api/preview":
+		return config.RoleRead
+	default:
+		return config.RoleAdmin
+	}
+}
+
+// allows reports whether role grants required
+func allows(role, required string) bool {
+	switch required {
+	case config.RoleRead:
+		return role == config.RoleRead || role == config.RoleAdmin
+	case config.RoleAdmin:
+		return role == config.RoleAdmin
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return header[7:], true
+	}
+	return "", false
+}
+
+// secretEqual compares in constant time, so the time taken does not
+// reveal how much of a guess was right
+func secretEqual(given, want string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+}
@@ -2,23 +2,37 @@ package monitoring
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"sync"
 
 	"cdrgenerator/config"
 	"cdrgenerator/format"
+	"cdrgenerator/output"
 )
 
+// ReloadFunc reloads the configuration file and applies it to the running
+// channels
+type ReloadFunc func() (*output.ReloadResult, error)
+
 // ConfigHandler handles configuration management requests
 type ConfigHandler struct {
 	configPath string
+	history    *config.History
+	reload     ReloadFunc
+
+	// Serializes changes to the config file
+	mu sync.Mutex
 }
 
-// NewConfigHandler creates a new config handler
-func NewConfigHandler(configPath string) *ConfigHandler {
+// NewConfigHandler creates a new config handler that keeps the last
+// historySize saved configs
+func NewConfigHandler(configPath string, historySize int) *ConfigHandler {
 	return &ConfigHandler{
 		configPath: configPath,
+		history:    config.NewHistory(config.HistoryDir(configPath), historySize),
 	}
 }
 
@@ -26,6 +40,21 @@ func NewConfigHandler(configPath string) *ConfigHandler {
 func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	switch r.URL.Path {
+	case "/api/config/reload":
+		h.reloadConfig(w, r)
+		return
+	case "/api/config/history":
+		h.listHistory(w, r)
+		return
+	case "/api/config/history/diff":
+		h.diffHistory(w, r)
+		return
+	case "/api/config/history/rollback":
+		h.rollback(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.getConfig(w, r)
@@ -43,6 +72,11 @@ func (h *ConfigHandler) getConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// API credentials are never served, even to admins
+	if cfg.Monitoring.Auth != nil {
+		cfg.Monitoring.Auth.Redact()
+	}
+
 	json.NewEncoder(w).Encode(cfg)
 }
 
@@ -53,33 +87,121 @@ func (h *ConfigHandler) saveConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var cfg config.Config
-	if err := json.Unmarshal(body, &cfg); err != nil {
+	// Defaults are applied as when loading, so fields left out validate
+	cfg, err := config.Parse(body)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Keep the stored secrets for credentials sent back redacted
+	if cfg.Monitoring.Auth != nil {
+		if current, err := config.Load(h.configPath); err == nil {
+			cfg.Monitoring.Auth.RestoreSecrets(current.Monitoring.Auth)
+		}
+	}
+
 	// Validate configuration
-	if err := config.Validate(&cfg, format.List()); err != nil {
+	if err := config.Validate(cfg, format.List()); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Save to file
-	data, err := json.MarshalIndent(&cfg, "", "  ")
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if err := os.WriteFile(h.configPath, data, 0644); err != nil {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeConfig(r, data, ""); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.applySaved(w)
+}
+
+// writeConfig replaces the config file with data and records it in the
+// history. Callers hold h.mu.
+func (h *ConfigHandler) writeConfig(r *http.Request, data []byte, note string) error {
+	// Keep edits made to the file by hand, so they can be rolled back to
+	if current, err := os.ReadFile(h.configPath); err == nil {
+		if _, err := h.history.RecordIfChanged(current, "file", "found on disk before saving"); err != nil {
+			return fmt.Errorf("failed to record config history: %w", err)
+		}
+	}
+
+	previous, hasPrevious, _ := h.history.Latest()
+
+	if err := config.WriteFile(h.configPath, data, 0644); err != nil {
+		return err
+	}
+
+	saved, err := h.history.Record(data, ActorFrom(r.Context()).Name, note)
+	if err != nil {
+		return fmt.Errorf("configuration saved but not recorded in history: %w", err)
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
+	if hasPrevious {
+		auditChange(r, map[string]int{"version": previous.Version}, map[string]int{"version": saved.Version})
+		if diff, err := h.diffVersions(previous.Version, saved.Version); err == nil {
+			auditDetail(r, diff)
+		}
+	} else {
+		auditChange(r, nil, map[string]int{"version": saved.Version})
+	}
+	return nil
+}
+
+// applySaved reloads a newly saved config, if reloading is enabled, and
+// writes the response
+func (h *ConfigHandler) applySaved(w http.ResponseWriter) {
+	if h.reload == nil {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status":  "success",
+			"message": "Configuration saved. Restart the service to apply changes.",
+		})
+		return
+	}
+
+	result, err := h.reload()
+	if err != nil {
+		http.Error(w, "Configuration saved but not applied: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "success",
-		"message": "Configuration saved. Restart the service to apply changes.",
+		"message": "Configuration saved and applied.",
+		"reload":  result,
+	})
+}
+
+// reloadConfig applies the configuration file to the running channels:
+// POST /api/config/reload
+func (h *ConfigHandler) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.reload == nil {
+		http.Error(w, "Reload not available", http.StatusNotImplemented)
+		return
+	}
+
+	result, err := h.reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	auditChange(r, nil, result)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"reload": result,
 	})
 }
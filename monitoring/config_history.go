@@ -0,0 +1,219 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"cdrgenerator/config"
+	"cdrgenerator/format"
+)
+
+// listHistory returns the saved config versions, newest first:
+// GET /api/config/history
+// With a version, it returns that version's config instead:
+// GET /api/config/history?version=3
+func (h *ConfigHandler) listHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Has("version") {
+		version, ok := versionParam(w, r, "version")
+		if !ok {
+			return
+		}
+		v, data, err := h.history.Get(version)
+		if err != nil {
+			writeHistoryError(w, err)
+			return
+		}
+		cfg, err := redactedConfig(data)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("version %d: %v", version, err), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": v,
+			"config":  cfg,
+		})
+		return
+	}
+
+	versions, err := h.history.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"versions": versions,
+	})
+}
+
+// diffHistory compares two saved versions:
+// GET /api/config/history/diff?from=2&to=5
+// to defaults to the newest version, and from to the one before to.
+// Credentials are redacted on both sides, so changed tokens and passwords
+// do not show.
+func (h *ConfigHandler) diffHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, err := h.history.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "No saved config versions", http.StatusNotFound)
+		return
+	}
+
+	to := versions[0].Version
+	if r.URL.Query().Has("to") {
+		if to, err = strconv.Atoi(r.URL.Query().Get("to")); err != nil {
+			http.Error(w, "to must be a version number", http.StatusBadRequest)
+			return
+		}
+	}
+	from := 0
+	if r.URL.Query().Has("from") {
+		if from, err = strconv.Atoi(r.URL.Query().Get("from")); err != nil {
+			http.Error(w, "from must be a version number", http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Versions are newest first, so the previous one follows to
+		for i, v := range versions {
+			if v.Version == to && i+1 < len(versions) {
+				from = versions[i+1].Version
+			}
+		}
+		if from == 0 {
+			http.Error(w, fmt.Sprintf("No version before %d to compare with", to), http.StatusNotFound)
+			return
+		}
+	}
+
+	diff, err := h.diffVersions(from, to)
+	if err != nil {
+		writeHistoryError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from": from,
+		"to":   to,
+		"diff": diff,
+	})
+}
+
+// rollback saves a previous version as the current config and applies it:
+// POST /api/config/history/rollback?version=3
+// The rollback is recorded as a new version, so it can be undone too.
+func (h *ConfigHandler) rollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := versionParam(w, r, "version")
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, data, err := h.history.Get(version)
+	if err != nil {
+		writeHistoryError(w, err)
+		return
+	}
+
+	// Files the old config refers to may have gone since
+	cfg, err := config.Parse(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("version %d: %v", version, err), http.StatusBadRequest)
+		return
+	}
+	if err := config.Validate(cfg, format.List()); err != nil {
+		http.Error(w, fmt.Sprintf("version %d: %v", version, err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.writeConfig(r, data, fmt.Sprintf("rollback to version %d", version)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.applySaved(w)
+}
+
+// diffVersions compares two versions with their credentials redacted
+func (h *ConfigHandler) diffVersions(from, to int) (string, error) {
+	fromText, err := h.redactedVersion(from)
+	if err != nil {
+		return "", err
+	}
+	toText, err := h.redactedVersion(to)
+	if err != nil {
+		return "", err
+	}
+	return config.Diff(fromText, toText, fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", to)), nil
+}
+
+// redactedVersion returns a version's config with its credentials
+// redacted, formatted the same way for every version so only real changes
+// show in a diff
+func (h *ConfigHandler) redactedVersion(version int) (string, error) {
+	_, data, err := h.history.Get(version)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := redactedConfig(data)
+	if err != nil {
+		return "", fmt.Errorf("version %d: %w", version, err)
+	}
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// redactedConfig parses a config file and redacts its credentials.
+// Defaults are filled in, so a hand-written file and the same config saved
+// through the API compare equal.
+func redactedConfig(data []byte) (*config.Config, error) {
+	cfg, err := config.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Monitoring.Auth != nil {
+		cfg.Monitoring.Auth.Redact()
+	}
+	return cfg, nil
+}
+
+// versionParam parses a version number query parameter, writing the error
+// response if it is missing or not a number
+func versionParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	version, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		http.Error(w, name+" parameter must be a version number", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+func writeHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, config.ErrUnknownVersion) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,214 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cdrgenerator/format"
+	"cdrgenerator/output"
+)
+
+// ControlHandler handles requests that change what a running channel does
+type ControlHandler struct {
+	manager *output.Manager
+}
+
+// NewControlHandler creates a new control handler
+func NewControlHandler(manager *output.Manager) *ControlHandler {
+	return &ControlHandler{
+		manager: manager,
+	}
+}
+
+// ServeHTTP dispatches /api/control/<action> requests
+func (h *ControlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		http.Error(w, "device parameter required", http.StatusBadRequest)
+		return
+	}
+
+	// For the audit log
+	before := h.manager.GetChannelStates()[device].State
+
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, "/api/control/") {
+	case "pause":
+		err = h.manager.PauseChannel(device)
+	case "resume":
+		err = h.manager.ResumeChannel(device)
+	case "send":
+		err = h.manager.SendNow(device)
+	case "rate":
+		h.rate(w, r, device)
+		return
+	case "linkfault":
+		h.linkFault(w, r, device)
+		return
+	case "inject":
+		h.inject(w, r, device)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		writeControlError(w, err)
+		return
+	}
+	if after := h.manager.GetChannelStates()[device].State; after != before {
+		auditChange(r, before, after)
+	}
+	h.writeChannel(w, device)
+}
+
+// rate changes the call rate and/or jitter of a channel:
+// POST /api/control/rate?device=X&cpm=5&jitter=20
+func (h *ControlHandler) rate(w http.ResponseWriter, r *http.Request, device string) {
+	info, ok := h.manager.GetChannelStates()[device]
+	if !ok {
+		writeControlError(w, fmt.Errorf("%w: %s", output.ErrUnknownDevice, device))
+		return
+	}
+
+	cpm, jitter := info.CallsPerMinute, info.JitterPercent
+	query := r.URL.Query()
+	if query.Get("cpm") == "" && query.Get("jitter") == "" {
+		http.Error(w, "cpm or jitter parameter required", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if v := query.Get("cpm"); v != "" {
+		if cpm, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "cpm must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("jitter"); v != "" {
+		if jitter, err = strconv.ParseFloat(v, 64); err != nil {
+			http.Error(w, "jitter must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.manager.SetChannelRate(device, cpm, jitter); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	auditChange(r,
+		map[string]float64{"calls_per_minute": info.CallsPerMinute, "jitter_percent": info.JitterPercent},
+		map[string]float64{"calls_per_minute": cpm, "jitter_percent": jitter})
+	h.writeChannel(w, device)
+}
+
+// writeChannel responds with the channel's current state
+func (h *ControlHandler) writeChannel(w http.ResponseWriter, device string) {
+	json.NewEncoder(w).Encode(h.manager.GetChannelStates()[device])
+}
+
+// linkFault starts a simulated link fault:
+// POST /api/control/linkfault?device=X&kind=drop&duration_ms=30000
+func (h *ControlHandler) linkFault(w http.ResponseWriter, r *http.Request, device string) {
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		http.Error(w, "kind parameter required", http.StatusBadRequest)
+		return
+	}
+
+	durationMs, err := strconv.Atoi(r.URL.Query().Get("duration_ms"))
+	if err != nil || durationMs <= 0 {
+		http.Error(w, "duration_ms must be a positive integer", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.manager.InjectLinkFault(device, kind, time.Duration(durationMs)*time.Millisecond); err != nil {
+		writeControlError(w, err)
+		return
+	}
+
+	auditChange(r, nil, map[string]interface{}{"kind": kind, "duration_ms": durationMs})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device":      device,
+		"kind":        kind,
+		"duration_ms": durationMs,
+		"status":      "started",
+	})
+}
+
+// injectRequest is the body of an inject request: either raw lines or
+// parameters for a call rendered in the channel's format
+type injectRequest struct {
+	Lines []string    `json:"lines,omitempty"`
+	Call  *injectCall `json:"call,omitempty"`
+}
+
+type injectCall struct {
+	format.CallParams
+	DurationSec float64 `json:"duration_sec,omitempty"`
+}
+
+// inject sends one specific record immediately:
+// POST /api/control/inject?device=X with {"lines": [...]} or {"call": {...}}
+func (h *ControlHandler) inject(w http.ResponseWriter, r *http.Request, device string) {
+	var req injectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (len(req.Lines) == 0) == (req.Call == nil) {
+		http.Error(w, "exactly one of lines or call required", http.StatusBadRequest)
+		return
+	}
+
+	var record *format.CDRRecord
+	var err error
+	if req.Call != nil {
+		params := req.Call.CallParams
+		params.Duration = time.Duration(req.Call.DurationSec * float64(time.Second))
+		record, err = h.manager.InjectCall(device, &params)
+	} else {
+		record, err = h.manager.InjectLines(device, req.Lines)
+	}
+	if err != nil {
+		writeControlError(w, err)
+		return
+	}
+
+	auditChange(r, nil, map[string]interface{}{
+		"record_id": record.ID,
+		"type":      record.Type,
+		"lines":     record.Lines,
+	})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device":    device,
+		"record_id": record.ID,
+		"type":      record.Type,
+		"lines":     record.Lines,
+	})
+}
+
+// writeControlError maps a control error to an HTTP status
+func writeControlError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, output.ErrUnknownDevice):
+		status = http.StatusNotFound
+	case errors.Is(err, output.ErrLinkFaultActive):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,70 @@
+package monitoring
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"cdrgenerator/output"
+)
+
+// LedgerHandler exports the sent-record ledger for reconciliation
+type LedgerHandler struct {
+	manager *output.Manager
+	logger  *slog.Logger
+}
+
+// NewLedgerHandler creates a new ledger handler
+func NewLedgerHandler(manager *output.Manager, logger *slog.Logger) *LedgerHandler {
+	return &LedgerHandler{
+		manager: manager,
+		logger:  logger,
+	}
+}
+
+// ServeHTTP returns ledger entries as JSONL:
+// GET /api/ledger?device=X&from=2025-01-01T00:00:00Z&to=2025-01-02T00:00:00Z
+func (h *LedgerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+
+	// Large exports can outlast the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	n, err := h.manager.ExportLedger(query.Get("device"), from, to, w)
+	switch {
+	case err == nil:
+	case errors.Is(err, output.ErrLedgerDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case n == 0:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		// The entries already sent went out with a 200; an error body
+		// would corrupt the JSONL, so all we can do is stop
+		h.logger.Error("Ledger export failed", "device", query.Get("device"), "entries", n, "error", err)
+	}
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -2,20 +2,25 @@ package monitoring
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 
 	"cdrgenerator/output"
 )
 
 // MetricsHandler creates an HTTP handler for Prometheus metrics
 type MetricsHandler struct {
-	manager *output.Manager
+	instanceID string
+	manager    *output.Manager
 }
 
-// NewMetricsHandler creates a new metrics handler
-func NewMetricsHandler(manager *output.Manager) *MetricsHandler {
+// NewMetricsHandler creates a new metrics handler. Every series carries
+// the instance ID as its instance label.
+func NewMetricsHandler(instanceID string, manager *output.Manager) *MetricsHandler {
 	return &MetricsHandler{
-		manager: manager,
+		instanceID: instanceID,
+		manager:    manager,
 	}
 }
 
@@ -29,8 +34,8 @@ func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "# HELP cdrgenerator_records_total Total CDR records sent")
 	fmt.Fprintln(w, "# TYPE cdrgenerator_records_total counter")
 	for _, info := range states {
-		fmt.Fprintf(w, "cdrgenerator_records_total{port=%q,format=%q,mode=%q} %d\n",
-			info.Device, info.Format, info.Mode, info.RecordsSent)
+		fmt.Fprintf(w, "cdrgenerator_records_total{instance=%q,port=%q,format=%q,mode=%q} %d\n",
+			h.instanceID, info.Device, info.Format, info.Mode, info.RecordsSent)
 	}
 
 	// Bytes total
@@ -38,8 +43,8 @@ func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "# HELP cdrgenerator_bytes_sent_total Total bytes sent")
 	fmt.Fprintln(w, "# TYPE cdrgenerator_bytes_sent_total counter")
 	for _, info := range states {
-		fmt.Fprintf(w, "cdrgenerator_bytes_sent_total{port=%q} %d\n",
-			info.Device, info.BytesSent)
+		fmt.Fprintf(w, "cdrgenerator_bytes_sent_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.BytesSent)
 	}
 
 	// Errors total
@@ -47,8 +52,8 @@ func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "# HELP cdrgenerator_port_errors_total Total port errors")
 	fmt.Fprintln(w, "# TYPE cdrgenerator_port_errors_total counter")
 	for _, info := range states {
-		fmt.Fprintf(w, "cdrgenerator_port_errors_total{port=%q} %d\n",
-			info.Device, info.Errors)
+		fmt.Fprintf(w, "cdrgenerator_port_errors_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.Errors)
 	}
 
 	// Port status
@@ -60,8 +65,129 @@ func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if info.State == "running" {
 			up = 1
 		}
-		fmt.Fprintf(w, "cdrgenerator_port_up{port=%q,format=%q} %d\n",
-			info.Device, info.Format, up)
+		fmt.Fprintf(w, "cdrgenerator_port_up{instance=%q,port=%q,format=%q} %d\n",
+			h.instanceID, info.Device, info.Format, up)
+	}
+
+	// Calls in progress (stream mode)
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_active_calls Calls with lines still to be written in stream mode")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_active_calls gauge")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_active_calls{instance=%q,port=%q,output_mode=%q} %d\n",
+			h.instanceID, info.Device, info.OutputMode, info.ActiveCalls)
+	}
+
+	// Receive side
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_bytes_received_total Total bytes received from collectors")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_bytes_received_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_bytes_received_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.BytesReceived)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_ack_responses_total Collector responses to records in ACK-required mode")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_ack_responses_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_ack_responses_total{instance=%q,port=%q,result=\"ack\"} %d\n", h.instanceID, info.Device, info.AcksReceived)
+		fmt.Fprintf(w, "cdrgenerator_ack_responses_total{instance=%q,port=%q,result=\"nak\"} %d\n", h.instanceID, info.Device, info.NaksReceived)
+		fmt.Fprintf(w, "cdrgenerator_ack_responses_total{instance=%q,port=%q,result=\"timeout\"} %d\n", h.instanceID, info.Device, info.AckTimeouts)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_retransmits_total Records retransmitted after a NAK or ACK timeout")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_retransmits_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_retransmits_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.Retransmits)
+	}
+
+	// Fault injection
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_faults_injected_total Faults deliberately injected into output")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_faults_injected_total counter")
+	for _, info := range states {
+		for kind, n := range info.FaultsInjected {
+			fmt.Fprintf(w, "cdrgenerator_faults_injected_total{instance=%q,port=%q,fault=%q} %d\n",
+				h.instanceID, info.Device, kind, n)
+		}
+	}
+
+	// Link faults
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_link_faults_total Simulated link faults started")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_link_faults_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_link_faults_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.LinkFaults)
+	}
+
+	// Flow control stalls
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_flow_control_stalls_total Writes held off waiting for CTS")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_flow_control_stalls_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_flow_control_stalls_total{instance=%q,port=%q,flow_control=%q} %d\n",
+			h.instanceID, info.Device, info.FlowControl, info.FlowStalls)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_flow_control_stall_seconds_total Total time spent waiting for CTS")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_flow_control_stall_seconds_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_flow_control_stall_seconds_total{instance=%q,port=%q} %g\n",
+			h.instanceID, info.Device, info.FlowStallSec)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_flow_control_timeouts_total Writes abandoned because CTS was never asserted")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_flow_control_timeouts_total counter")
+	for _, info := range states {
+		fmt.Fprintf(w, "cdrgenerator_flow_control_timeouts_total{instance=%q,port=%q} %d\n",
+			h.instanceID, info.Device, info.FlowTimeouts)
+	}
+
+	// Tee devices
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_tee_records_total Total CDR records sent to tee devices")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_tee_records_total counter")
+	for _, info := range states {
+		for _, tee := range info.Tees {
+			fmt.Fprintf(w, "cdrgenerator_tee_records_total{instance=%q,port=%q,tee=%q} %d\n",
+				h.instanceID, info.Device, tee.Device, tee.RecordsSent)
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_tee_bytes_sent_total Total bytes sent to tee devices")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_tee_bytes_sent_total counter")
+	for _, info := range states {
+		for _, tee := range info.Tees {
+			fmt.Fprintf(w, "cdrgenerator_tee_bytes_sent_total{instance=%q,port=%q,tee=%q} %d\n",
+				h.instanceID, info.Device, tee.Device, tee.BytesSent)
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_tee_errors_total Total tee device errors")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_tee_errors_total counter")
+	for _, info := range states {
+		for _, tee := range info.Tees {
+			fmt.Fprintf(w, "cdrgenerator_tee_errors_total{instance=%q,port=%q,tee=%q} %d\n",
+				h.instanceID, info.Device, tee.Device, tee.Errors)
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_tee_dropped_total Records dropped because a tee device was slow or down")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_tee_dropped_total counter")
+	for _, info := range states {
+		for _, tee := range info.Tees {
+			fmt.Fprintf(w, "cdrgenerator_tee_dropped_total{instance=%q,port=%q,tee=%q} %d\n",
+				h.instanceID, info.Device, tee.Device, tee.Dropped)
+		}
 	}
 
 	// Last record timestamp
@@ -70,8 +196,97 @@ func (h *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintln(w, "# TYPE cdrgenerator_last_record_timestamp gauge")
 	for _, info := range states {
 		if !info.LastRecordTime.IsZero() {
-			fmt.Fprintf(w, "cdrgenerator_last_record_timestamp{port=%q} %d\n",
-				info.Device, info.LastRecordTime.Unix())
+			fmt.Fprintf(w, "cdrgenerator_last_record_timestamp{instance=%q,port=%q} %d\n",
+				h.instanceID, info.Device, info.LastRecordTime.Unix())
 		}
 	}
+
+	h.writeDeliveryMetrics(w)
+}
+
+// writeDeliveryMetrics writes the metrics that show whether each port is
+// keeping up with its configured rate
+func (h *MetricsHandler) writeDeliveryMetrics(w io.Writer) {
+	metrics := h.manager.GetChannelMetrics()
+	devices := make([]string, 0, len(metrics))
+	for device := range metrics {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_calls_per_minute Configured record rate")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_calls_per_minute gauge")
+	for _, device := range devices {
+		fmt.Fprintf(w, "cdrgenerator_calls_per_minute{instance=%q,port=%q} %g\n",
+			h.instanceID, device, metrics[device].CallsPerMinute)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_records_by_type_total CDR records sent by record type")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_records_by_type_total counter")
+	for _, device := range devices {
+		byType := metrics[device].RecordsByType
+		types := make([]string, 0, len(byType))
+		for t := range byType {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			fmt.Fprintf(w, "cdrgenerator_records_by_type_total{instance=%q,port=%q,type=%q} %d\n",
+				h.instanceID, device, t, byType[t])
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_skipped_ticks_total Rate ticks dropped because the port was still busy with the last record")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_skipped_ticks_total counter")
+	for _, device := range devices {
+		fmt.Fprintf(w, "cdrgenerator_skipped_ticks_total{instance=%q,port=%q} %d\n",
+			h.instanceID, device, metrics[device].SkippedTicks)
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "# HELP cdrgenerator_reconnect_attempts_total Attempts to reopen a lost port")
+	fmt.Fprintln(w, "# TYPE cdrgenerator_reconnect_attempts_total counter")
+	for _, device := range devices {
+		fmt.Fprintf(w, "cdrgenerator_reconnect_attempts_total{instance=%q,port=%q} %d\n",
+			h.instanceID, device, metrics[device].ReconnectAttempts)
+	}
+
+	histograms := []struct {
+		name string
+		help string
+		get  func(output.ChannelMetrics) output.HistogramSnapshot
+	}{
+		{"cdrgenerator_record_interval_seconds", "Time between records sent",
+			func(m output.ChannelMetrics) output.HistogramSnapshot { return m.RecordInterval }},
+		{"cdrgenerator_write_duration_seconds", "Time to write a record to the port",
+			func(m output.ChannelMetrics) output.HistogramSnapshot { return m.WriteLatency }},
+		{"cdrgenerator_flush_duration_seconds", "Time for the port to drain after a write",
+			func(m output.ChannelMetrics) output.HistogramSnapshot { return m.FlushLatency }},
+		{"cdrgenerator_record_size_bytes", "Bytes written per record",
+			func(m output.ChannelMetrics) output.HistogramSnapshot { return m.RecordSize }},
+		{"cdrgenerator_reconnect_duration_seconds", "Time from losing a port to reopening it",
+			func(m output.ChannelMetrics) output.HistogramSnapshot { return m.ReconnectDuration }},
+	}
+	for _, hist := range histograms {
+		fmt.Fprintln(w, "")
+		fmt.Fprintf(w, "# HELP %s %s\n", hist.name, hist.help)
+		fmt.Fprintf(w, "# TYPE %s histogram\n", hist.name)
+		for _, device := range devices {
+			h.writeHistogram(w, hist.name, device, hist.get(metrics[device]))
+		}
+	}
+}
+
+// writeHistogram writes the bucket, sum and count series of one histogram
+func (h *MetricsHandler) writeHistogram(w io.Writer, name, device string, s output.HistogramSnapshot) {
+	for i, bound := range s.Bounds {
+		fmt.Fprintf(w, "%s_bucket{instance=%q,port=%q,le=\"%g\"} %d\n",
+			name, h.instanceID, device, bound, s.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{instance=%q,port=%q,le=\"+Inf\"} %d\n", name, h.instanceID, device, s.Count)
+	fmt.Fprintf(w, "%s_sum{instance=%q,port=%q} %g\n", name, h.instanceID, device, s.Sum)
+	fmt.Fprintf(w, "%s_count{instance=%q,port=%q} %d\n", name, h.instanceID, device, s.Count)
 }
@@ -0,0 +1,136 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"cdrgenerator/config"
+	"cdrgenerator/format"
+	"cdrgenerator/output"
+)
+
+// Preview limits
+const (
+	defaultPreviewCount = 10
+	maxPreviewCount     = 1000
+)
+
+// PreviewHandler shows the records a port config would produce, without
+// opening any device
+type PreviewHandler struct {
+	configPath string
+}
+
+// NewPreviewHandler creates a new preview handler
+func NewPreviewHandler(configPath string) *PreviewHandler {
+	return &PreviewHandler{
+		configPath: configPath,
+	}
+}
+
+// ServeHTTP previews a port sent in the body, or a port of the config file:
+// POST /api/preview?count=10 with a port config
+// GET /api/preview?device=X&count=10
+func (h *PreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	count := defaultPreviewCount
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPreviewCount {
+			http.Error(w, fmt.Sprintf("count must be between 1 and %d", maxPreviewCount), http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := config.Load(h.configPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var port *config.PortConfig
+	if r.Method == http.MethodGet {
+		port, err = configuredPort(cfg, r.URL.Query().Get("device"))
+	} else {
+		port, err = readPreviewPort(cfg, r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := output.Preview(port, count, cfg.App.StateFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device":  port.Device,
+		"format":  port.Format,
+		"mode":    port.Mode,
+		"records": records,
+	})
+}
+
+// configuredPort returns the port for device from the config file
+func configuredPort(cfg *config.Config, device string) (*config.PortConfig, error) {
+	if device == "" {
+		return nil, fmt.Errorf("device parameter required")
+	}
+	for i := range cfg.Ports {
+		if cfg.Ports[i].Device == device {
+			return &cfg.Ports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no port for device %s in the config file", device)
+}
+
+// readPreviewPort reads and validates a port config from the request
+// body. The device is optional, as it is never opened. Previews need only
+// the read role, so a replay port may only use the sample file of a
+// configured port; any other path would let readers probe and read files
+// on the server.
+func readPreviewPort(cfg *config.Config, r *http.Request) (*config.PortConfig, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	port, err := config.ParsePort(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port config: %w", err)
+	}
+	if port.Device == "" {
+		port.Device = "preview"
+	}
+	if port.SampleFile != "" {
+		if err := checkSampleFile(cfg, port.SampleFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.ValidatePort(port, format.List()); err != nil {
+		return nil, err
+	}
+	return port, nil
+}
+
+// checkSampleFile allows only the sample files of the configured ports
+func checkSampleFile(cfg *config.Config, path string) error {
+	for _, port := range cfg.Ports {
+		if port.SampleFile != "" && filepath.Clean(port.SampleFile) == filepath.Clean(path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("sample_file must be the sample file of a configured port")
+}
@@ -5,9 +5,12 @@ import (
 	_ "embed"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"cdrgenerator/audit"
 	"cdrgenerator/config"
 	"cdrgenerator/output"
 )
@@ -21,6 +24,9 @@ type Server struct {
 	manager *output.Manager
 	server  *http.Server
 	logger  *slog.Logger
+
+	configHandler *ConfigHandler
+	auditor       *auditor
 }
 
 // NewServer creates a new monitoring server
@@ -37,17 +43,40 @@ func NewServerWithConfigPath(cfg *config.MonitoringConfig, instanceID, version s
 	mux.Handle("/health", healthHandler)
 
 	// Metrics endpoint (Prometheus format)
-	metricsHandler := NewMetricsHandler(manager)
+	metricsHandler := NewMetricsHandler(instanceID, manager)
 	mux.Handle("/metrics", metricsHandler)
 
 	// Config endpoint
-	configHandler := NewConfigHandler(configPath)
+	configHandler := NewConfigHandler(configPath, cfg.ConfigHistory)
 	mux.Handle("/api/config", configHandler)
+	mux.Handle("/api/config/reload", configHandler)
+	mux.Handle("/api/config/history", configHandler)
+	mux.Handle("/api/config/history/", configHandler)
 
 	// Records endpoint
 	recordsHandler := NewRecordsHandler(manager)
 	mux.Handle("/api/records", recordsHandler)
 
+	// Control endpoints for running channels
+	controlHandler := NewControlHandler(manager)
+	mux.Handle("/api/control/", controlHandler)
+
+	// Records a port config would produce
+	previewHandler := NewPreviewHandler(configPath)
+	mux.Handle("/api/preview", previewHandler)
+
+	// Sent-record ledger export
+	ledgerHandler := NewLedgerHandler(manager, logger)
+	mux.Handle("/api/ledger", ledgerHandler)
+
+	// Live event stream
+	streamHandler := NewStreamHandler(manager)
+	mux.Handle("/api/stream", streamHandler)
+
+	// Audit log of changes
+	auditor := &auditor{}
+	mux.Handle("/api/audit", &AuditHandler{auditor: auditor})
+
 	// System ports endpoint
 	sysPortsHandler := NewSysPortsHandler()
 	mux.Handle("/api/sysports", sysPortsHandler)
@@ -62,25 +91,65 @@ func NewServerWithConfigPath(cfg *config.MonitoringConfig, instanceID, version s
 		fmt.Fprint(w, dashboardHTML)
 	})
 
+	// Credentials are checked before any handler runs
+	auth := newAuthenticator(cfg.Auth, logger)
+	auth.adminClientCert = cfg.TLS != nil && cfg.TLS.AdminClientCert
+
+	server := &http.Server{
+		Addr:         net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.Port)),
+		Handler:      auth.wrap(auditor.wrap(mux)),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	server.RegisterOnShutdown(streamHandler.Close)
+
 	return &Server{
-		config:  cfg,
-		manager: manager,
-		server: &http.Server{
-			Addr:         fmt.Sprintf(":%d", cfg.Port),
-			Handler:      mux,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-		},
-		logger: logger,
+		config:        cfg,
+		manager:       manager,
+		server:        server,
+		logger:        logger,
+		configHandler: configHandler,
+		auditor:       auditor,
 	}
 }
 
+// SetReloader enables applying configuration changes without a restart,
+// both for saved configs and the reload endpoint
+func (s *Server) SetReloader(reload ReloadFunc) {
+	s.configHandler.reload = reload
+}
+
+// SetAuditLog records every change made through the API in log, and
+// serves it at /api/audit
+func (s *Server) SetAuditLog(log *audit.Log) {
+	s.auditor.log = log
+}
+
 // Start starts the monitoring server
 func (s *Server) Start() error {
-	s.logger.Info("Starting monitoring server", "port", s.config.Port)
+	if s.config.TLS != nil {
+		reloader, err := newTLSReloader(s.config.TLS, s.logger)
+		if err != nil {
+			return err
+		}
+		s.server.TLSConfig = reloader.serverConfig()
+	}
+
+	s.logger.Info("Starting monitoring server",
+		"address", s.server.Addr,
+		"tls", s.config.TLS != nil,
+		"auth", s.config.Auth != nil,
+	)
 
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.server.TLSConfig != nil {
+			// The certificate comes from TLSConfig so it can be reloaded
+			err = s.server.ListenAndServeTLS("", "")
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Error("Monitoring server error", "error", err)
 		}
 	}()
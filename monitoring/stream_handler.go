@@ -0,0 +1,115 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cdrgenerator/output"
+)
+
+const (
+	// streamBuffer is how many events a slow client may fall behind by
+	// before events are dropped
+	streamBuffer = 256
+
+	// streamHeartbeat keeps idle connections open through proxies
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamHandler streams channel events to clients as Server-Sent Events
+type StreamHandler struct {
+	manager *output.Manager
+
+	// Closed when the server shuts down, which would otherwise wait for
+	// every stream to end
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStreamHandler creates a new stream handler
+func NewStreamHandler(manager *output.Manager) *StreamHandler {
+	return &StreamHandler{
+		manager: manager,
+		done:    make(chan struct{}),
+	}
+}
+
+// Close ends all open streams
+func (h *StreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// ServeHTTP streams events until the client disconnects:
+// GET /api/stream?device=X&format=vesta&type=cdr&events=record,state
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := output.EventFilter{
+		Device:     query.Get("device"),
+		Format:     query.Get("format"),
+		RecordType: query.Get("type"),
+	}
+	if events := query.Get("events"); events != "" {
+		filter.Types = strings.Split(events, ",")
+	}
+
+	// The server's write timeout would otherwise end the stream
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.manager.Events().Subscribe(filter, streamBuffer)
+	defer h.manager.Events().Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	var reported int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		case event := <-sub.C:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Tell the client if it missed events since the last heartbeat
+			if dropped := sub.Dropped(); dropped > reported {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped-reported)
+				reported = dropped
+			}
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
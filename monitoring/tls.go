@@ -0,0 +1,127 @@
+package monitoring
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"cdrgenerator/config"
+)
+
+// tlsCheckInterval limits how often the certificate files are checked for
+// changes
+const tlsCheckInterval = 10 * time.Second
+
+// tlsReloader serves the monitoring server's certificate, reading the
+// files again when they change so a renewed certificate is picked up
+// without restarting anything
+type tlsReloader struct {
+	cfg    *config.TLSConfig
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	config    *tls.Config
+	modTimes  [3]time.Time // Cert, key and client CA files
+	lastCheck time.Time
+}
+
+// newTLSReloader loads the certificate and client CAs
+func newTLSReloader(cfg *config.TLSConfig, logger *slog.Logger) (*tlsReloader, error) {
+	r := &tlsReloader{cfg: cfg, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// serverConfig returns the TLS config for the HTTP server. Each handshake
+// asks the reloader for the current certificate and CAs.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// current returns the TLS config to use, reloading it first if the files
+// have changed
+func (r *tlsReloader) current() *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= tlsCheckInterval {
+		r.lastCheck = time.Now()
+		if r.changed() {
+			if err := r.loadLocked(); err != nil {
+				// Keep serving the old certificate until the new one is valid
+				r.logger.Error("Failed to reload TLS certificate", "error", err)
+			} else {
+				r.logger.Info("Reloaded TLS certificate", "cert_file", r.cfg.CertFile)
+			}
+		}
+	}
+	return r.config
+}
+
+func (r *tlsReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.loadLocked()
+}
+
+func (r *tlsReloader) loadLocked() error {
+	modTimes := r.statFiles()
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	// Client certificates are checked if given; whether one is required
+	// depends on the request, see authenticator
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.cfg.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r.config = config
+	r.modTimes = modTimes
+	return nil
+}
+
+// changed reports whether any of the files was modified since the last load
+func (r *tlsReloader) changed() bool {
+	return r.statFiles() != r.modTimes
+}
+
+func (r *tlsReloader) statFiles() [3]time.Time {
+	var times [3]time.Time
+	for i, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
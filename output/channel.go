@@ -2,12 +2,15 @@ package output
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"sync"
 	"time"
 
 	"cdrgenerator/config"
+	"cdrgenerator/format"
 	"cdrgenerator/generator"
 	"cdrgenerator/serial"
 )
@@ -22,16 +25,40 @@ const (
 	StateReconnecting ChannelState = "reconnecting"
 	StateStopped      ChannelState = "stopped"
 	StateError        ChannelState = "error"
+	StateLinkFault    ChannelState = "link_fault" // Simulated outage, see InjectLinkFault
+	StateWaiting      ChannelState = "waiting"    // Outside the port's scheduled run
 )
 
 // Channel manages output to a single serial port
 type Channel struct {
-	config     *config.PortConfig
-	recovery   *config.RecoveryConfig
-	generator  *generator.Generator
-	port       serial.Port
-	portStats  *serial.PortWithStats
-	logger     *slog.Logger
+	config    *config.PortConfig
+	recovery  *config.RecoveryConfig
+	generator *generator.Generator
+	port      serial.Port
+	portStats *serial.PortWithStats
+	portMutex sync.RWMutex // Guards port replacement against the receive loop
+	logger    *slog.Logger
+
+	// Encodes record lines for the wire
+	framer *framer
+
+	// Corrupts output for robustness testing; nil when disabled
+	faults *faultInjector
+
+	// Extra devices receiving a copy of every record
+	tees []*teeOutput
+
+	// Live subscribers to records and state changes; may be nil
+	events *EventBus
+
+	// Durable log of every record sent; nil when disabled
+	ledger *ledger
+
+	// Paces the output loop; created by Start
+	ticker *generator.Ticker
+
+	// Latency, interval and size histograms for /metrics
+	metrics *channelMetrics
 
 	state      ChannelState
 	stateMutex sync.RWMutex
@@ -45,6 +72,30 @@ type Channel struct {
 	recentIndex   int
 	recentMutex   sync.RWMutex
 
+	// Receive side
+	receiving bool
+	ackCh     chan bool
+	rxWg      sync.WaitGroup
+
+	// Stream mode: lines of in-progress calls, owned by the output loop
+	streamQueue streamQueue
+	streamSeq   int64
+	streamTimer *time.Timer // Fires when the next line is due; reused
+
+	// Runtime control, carried out by the output loop
+	controlCh chan controlRequest
+	paused    bool
+	linkFault *activeLinkFault
+
+	// Records a batching port has queued, by ID; owned by the output loop
+	deferred map[string]*deferredRecord
+
+	// Run schedule, owned by the output loop; nil when the channel always runs
+	schedule      *runSchedule
+	schedulePhase schedulePhase
+	scheduleTimer *time.Timer
+	done          chan struct{}
+
 	// Control
 	stopCh chan struct{}
 	wg     sync.WaitGroup
@@ -58,6 +109,33 @@ type ChannelStats struct {
 	LastRecordTime time.Time
 	StartTime      time.Time
 	LastError      string
+
+	// Flow control stalls (rtscts only)
+	FlowControlStalls    int64
+	FlowControlStallTime time.Duration
+	FlowControlTimeouts  int64
+
+	// Receive side
+	BytesReceived   int64
+	LastReceiveTime time.Time
+	AcksReceived    int64
+	NaksReceived    int64
+	AckTimeouts     int64
+	Retransmits     int64
+
+	// Calls with lines still to be written (stream mode only)
+	ActiveCalls int64
+
+	// Records sent on request through SendNow
+	ManualSends int64
+
+	// Records sent on request through InjectCall or InjectLines
+	RecordsInjected int64
+
+	// Simulated link faults
+	LinkFaults     int64
+	LinkFault      string // Kind of the fault in progress, if any
+	LinkFaultUntil time.Time
 }
 
 // RecentRecord represents a recently sent CDR
@@ -74,19 +152,34 @@ func NewChannel(
 	gen *generator.Generator,
 	logger *slog.Logger,
 ) *Channel {
-	return &Channel{
+	c := &Channel{
 		config:        portCfg,
 		recovery:      recoveryCfg,
 		generator:     gen,
 		logger:        logger.With("device", portCfg.Device, "format", portCfg.Format),
 		state:         StateInitializing,
 		stopCh:        make(chan struct{}),
+		ackCh:         make(chan bool, 16),
+		controlCh:     make(chan controlRequest),
+		done:          make(chan struct{}),
 		recentRecords: make([]RecentRecord, 10), // Store last 10 records
 		recentIndex:   0,
+		framer:        newFramer(portCfg.Framing),
+		metrics:       newChannelMetrics(),
 		stats: ChannelStats{
 			StartTime: time.Now(),
 		},
 	}
+
+	if portCfg.Faults != nil && portCfg.Faults.Enabled {
+		c.faults = newFaultInjector(portCfg.Faults, gen.Format(), c.logger)
+	}
+
+	for _, teeCfg := range portCfg.Tee {
+		c.tees = append(c.tees, newTeeOutput(portCfg, teeCfg, recoveryCfg, c.logger))
+	}
+
+	return c
 }
 
 // Start begins the output channel
@@ -99,27 +192,70 @@ func (c *Channel) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to open port: %w", err)
 	}
 
+	for _, tee := range c.tees {
+		tee.start()
+	}
+
+	// Start the receive loop if the device can be read from
+	if c.config.Receive != nil && c.config.Receive.Enabled {
+		if _, ok := serial.Unwrap(c.port).(io.Reader); ok {
+			c.receiving = true
+			c.rxWg.Add(1)
+			go c.receiveLoop()
+		} else {
+			c.logger.Warn("Device does not support receive, ignoring receive settings")
+		}
+	}
+
+	if c.config.Schedule != nil {
+		c.schedule = newRunSchedule(c.config.Schedule, time.Now())
+		c.schedulePhase = phaseActive
+	}
+
 	c.setState(StateRunning)
 	c.logger.Info("Output channel started",
 		"mode", c.generator.Mode(),
 		"calls_per_minute", c.config.CallsPerMinute,
+		"output_mode", c.config.OutputMode,
+		"tees", len(c.tees),
 	)
 
 	// Start the output loop
+	c.ticker = generator.NewTicker(c.generator.RateLimiter())
 	c.wg.Add(1)
 	go c.outputLoop(ctx)
 
+	for _, lf := range c.config.LinkFaults {
+		c.wg.Add(1)
+		go c.runLinkFaultSchedule(lf)
+	}
+
 	return nil
 }
 
-// Stop gracefully stops the output channel
+// Stop gracefully stops the output channel. Stopping it again does nothing.
 func (c *Channel) Stop() {
+	if c.stopped() {
+		return
+	}
 	c.logger.Info("Stopping output channel")
 	close(c.stopCh)
 	c.wg.Wait()
 
 	if c.port != nil {
 		c.port.Close()
+		c.takeDeliveries()
+	}
+
+	// Closing the port unblocks any read in progress
+	c.rxWg.Wait()
+
+	for _, tee := range c.tees {
+		tee.stop()
+	}
+
+	if c.ledger != nil {
+		c.ledger.Close()
 	}
 
 	c.setState(StateStopped)
@@ -129,6 +265,26 @@ func (c *Channel) Stop() {
 	)
 }
 
+// stopped returns true once Stop has been called
+func (c *Channel) stopped() bool {
+	select {
+	case <-c.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// markFailed reports a stopped channel that could not be started again
+func (c *Channel) markFailed(err error) {
+	c.statsMutex.Lock()
+	c.stats.Errors++
+	c.stats.LastError = err.Error()
+	c.statsMutex.Unlock()
+
+	c.setState(StateError)
+}
+
 // State returns the current channel state
 func (c *Channel) State() ChannelState {
 	c.stateMutex.RLock()
@@ -145,48 +301,53 @@ func (c *Channel) Stats() ChannelStats {
 
 func (c *Channel) setState(state ChannelState) {
 	c.stateMutex.Lock()
-	defer c.stateMutex.Unlock()
+	previous := c.state
 	c.state = state
+	c.stateMutex.Unlock()
+
+	if state != previous {
+		c.events.Publish(Event{
+			Type:          EventState,
+			Time:          time.Now(),
+			Device:        c.config.Device,
+			Format:        c.config.Format,
+			State:         string(state),
+			PreviousState: string(previous),
+		})
+	}
 }
 
 func (c *Channel) openPort() error {
-	// Special case: "stdout" device for testing
-	if c.config.Device == "stdout" {
-		c.port = serial.NewStdoutPort("stdout")
-		c.portStats = serial.NewPortWithStats(c.port)
-		return nil
-	}
-
-	// Special case: "null" device for silent testing
-	if c.config.Device == "null" || c.config.Device == "/dev/null" {
-		c.port = serial.NewMockPort("null")
-		c.portStats = serial.NewPortWithStats(c.port)
-		return nil
-	}
-
-	portCfg := serial.PortConfig{
-		Device:   c.config.Device,
-		BaudRate: c.config.BaudRate,
-		DataBits: c.config.DataBits,
-		StopBits: c.config.StopBits,
-		Parity:   c.config.Parity,
-	}
-
-	port, err := serial.Open(portCfg)
+	port, err := openDevice(c.config, c.logger)
 	if err != nil {
 		return err
 	}
+	port = paceDevice(c.config, port, c.stopCh, c.logger)
 
+	c.portMutex.Lock()
 	c.port = port
 	c.portStats = serial.NewPortWithStats(port)
+	c.portMutex.Unlock()
 	return nil
 }
 
+// currentPort returns the open port for use outside the output loop
+func (c *Channel) currentPort() serial.Port {
+	c.portMutex.RLock()
+	defer c.portMutex.RUnlock()
+	return c.port
+}
+
 func (c *Channel) outputLoop(ctx context.Context) {
 	defer c.wg.Done()
 
-	ticker := generator.NewTicker(c.generator.RateLimiter())
-	defer ticker.Stop()
+	defer c.ticker.Stop()
+
+	if c.config.IsStreaming() {
+		defer c.discardStreamLines()
+	}
+
+	c.updateSchedule()
 
 	for {
 		select {
@@ -194,10 +355,36 @@ func (c *Channel) outputLoop(ctx context.Context) {
 			return
 		case <-c.stopCh:
 			return
-		case <-ticker.C:
+		case req := <-c.controlCh:
+			req.result <- req.fn(ctx)
+		case <-c.linkFaultDone():
+			c.endLinkFault()
+		case <-c.deliveriesReady():
+			c.takeDeliveries()
+		case <-c.scheduleDue():
+			c.updateSchedule()
+		case <-c.ticker.C:
+			if c.paused || c.linkSilent() || !c.scheduleActive() {
+				continue
+			}
+			if c.config.IsStreaming() {
+				if _, err := c.startStreamCall(ctx); err != nil {
+					c.handleError(err)
+				} else {
+					c.countScheduledRecord()
+				}
+				c.writeDueLines()
+				c.checkFinished()
+				continue
+			}
 			if err := c.sendNextRecord(ctx); err != nil {
 				c.handleError(err)
+			} else {
+				c.countScheduledRecord()
 			}
+		case <-c.nextStreamDue():
+			c.writeDueLines()
+			c.checkFinished()
 		}
 	}
 }
@@ -209,18 +396,51 @@ func (c *Channel) sendNextRecord(ctx context.Context) error {
 		return fmt.Errorf("failed to get next record: %w", err)
 	}
 
-	// Write to port
-	data := record.Output()
-	n, err := c.portStats.Write(data)
-	if err != nil {
-		return fmt.Errorf("failed to write to port: %w", err)
+	return c.sendRecord(record)
+}
+
+// sendRecord frames a record and writes it to the port and any tees
+func (c *Channel) sendRecord(record *format.CDRRecord) error {
+	// Apply any faults, then write to port
+	keep, faults := c.applyLineFaults(record.ID, record.Lines)
+	lines := make([]string, len(keep))
+	for i, j := range keep {
+		lines[i] = record.Lines[j]
 	}
 
-	// Flush to ensure data is sent
-	if err := c.port.Flush(); err != nil {
-		c.logger.Warn("Failed to flush port", "error", err)
+	w := c.applyWriteFaults(record.ID, c.framer.frameRecord(lines))
+	w.faults = append(faults, w.faults...)
+	data := w.data()
+
+	meta := serial.RecordMeta{
+		ID:        record.ID,
+		Type:      record.Type,
+		Timestamp: record.Timestamp,
+		Format:    c.config.Format,
+		Lines:     lines,
+	}
+
+	// Tees get their copy first so a failing primary does not starve them.
+	// They get the corrupted bytes, but once and unsplit: duplicates and
+	// split pauses are only played out on the primary.
+	for _, tee := range c.tees {
+		tee.enqueue(meta, data)
 	}
 
+	n, err := c.transmitFaulted(meta, w)
+	if err != nil {
+		return err
+	}
+	if c.deferRecord(record, data, w.faults) {
+		return nil
+	}
+
+	c.recordSent(record, data, n, w.faults)
+	return nil
+}
+
+// recordSent accounts for a record once it has reached the port
+func (c *Channel) recordSent(record *format.CDRRecord, data []byte, n int, faults []Fault) {
 	// Update statistics
 	c.statsMutex.Lock()
 	c.stats.RecordsSent++
@@ -230,15 +450,69 @@ func (c *Channel) sendNextRecord(ctx context.Context) error {
 
 	// Store in recent records buffer
 	c.storeRecentRecord(data, n)
+	c.publishRecord(record.ID, record.Type, data, n, faults)
+	c.recordLedger(record, n, faults)
+	c.observeRecord(record.Type, n)
 
 	c.portStats.RecordSent()
 
 	c.logger.Debug("Sent record",
 		"record_id", record.ID,
 		"bytes", n,
+		"faults", len(faults),
 	)
+}
 
-	return nil
+// writeRecord writes one copy of a record to the primary port and flushes it
+func (c *Channel) writeRecord(meta serial.RecordMeta, data []byte) (int, error) {
+	flow, hasFlow := serial.Unwrap(c.port).(serial.FlowReporter)
+	var flowBefore serial.FlowStats
+	if hasFlow {
+		flowBefore = flow.FlowStats()
+	}
+
+	start := time.Now()
+	n, err := c.portStats.WriteRecord(meta, data)
+	c.metrics.writeLatency.Observe(time.Since(start).Seconds())
+
+	if hasFlow {
+		c.recordFlowStalls(flowBefore, flow.FlowStats())
+	}
+	if errors.Is(err, serial.ErrQueued) {
+		// Accounted for when the port reports the delivery
+		c.deferWrite(meta)
+		return 0, nil
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to write to port: %w", err)
+	}
+
+	// Flush to ensure data is sent
+	start = time.Now()
+	if err := c.port.Flush(); err != nil {
+		c.logger.Warn("Failed to flush port", "error", err)
+	}
+	c.metrics.flushLatency.Observe(time.Since(start).Seconds())
+
+	return n, nil
+}
+
+// recordFlowStalls adds any flow control stalls from the last write
+func (c *Channel) recordFlowStalls(before, after serial.FlowStats) {
+	if after.Stalls == before.Stalls {
+		return
+	}
+
+	c.statsMutex.Lock()
+	c.stats.FlowControlStalls += after.Stalls - before.Stalls
+	c.stats.FlowControlStallTime += after.StallTime - before.StallTime
+	c.stats.FlowControlTimeouts += after.Timeouts - before.Timeouts
+	c.statsMutex.Unlock()
+
+	c.logger.Debug("Write held by flow control",
+		"stall", after.StallTime-before.StallTime,
+		"timed_out", after.Timeouts > before.Timeouts,
+	)
 }
 
 func (c *Channel) handleError(err error) {
@@ -257,6 +531,7 @@ func (c *Channel) handleError(err error) {
 
 func (c *Channel) reconnect() {
 	c.setState(StateReconnecting)
+	started := time.Now()
 
 	delay := c.recovery.GetReconnectDelay()
 	maxDelay := c.recovery.GetMaxReconnectDelay()
@@ -270,6 +545,7 @@ func (c *Channel) reconnect() {
 		}
 
 		attempt++
+		c.countReconnectAttempt()
 		c.logger.Info("Attempting to reconnect", "attempt", attempt, "delay", delay)
 
 		time.Sleep(delay)
@@ -287,8 +563,9 @@ func (c *Channel) reconnect() {
 			continue
 		}
 
+		c.metrics.reconnectDuration.Observe(time.Since(started).Seconds())
 		c.logger.Info("Reconnected successfully", "attempt", attempt)
-		c.setState(StateRunning)
+		c.setState(c.idleState())
 		return
 	}
 }
@@ -298,6 +575,33 @@ func (c *Channel) Device() string {
 	return c.config.Device
 }
 
+// PTYPaths returns the slave path and symlink of a pty:// device.
+// Both are empty for other device types.
+func (c *Channel) PTYPaths() (slave, link string) {
+	if pty, ok := serial.Unwrap(c.currentPort()).(*serial.PTYPort); ok {
+		return pty.SlavePath(), pty.LinkPath()
+	}
+	return "", ""
+}
+
+// TeeStats returns statistics for each tee device
+func (c *Channel) TeeStats() []TeeStats {
+	stats := make([]TeeStats, 0, len(c.tees))
+	for _, tee := range c.tees {
+		stats = append(stats, tee.Stats())
+	}
+	return stats
+}
+
+// FaultCounts returns the number of faults injected by kind, or nil if
+// fault injection is disabled
+func (c *Channel) FaultCounts() map[string]int64 {
+	if c.faults == nil {
+		return nil
+	}
+	return c.faults.Counts()
+}
+
 // Format returns the format name
 func (c *Channel) Format() string {
 	return c.config.Format
@@ -308,6 +612,22 @@ func (c *Channel) Mode() string {
 	return c.config.Mode
 }
 
+// Rate returns the current calls per minute and jitter percent
+func (c *Channel) Rate() (callsPerMinute, jitterPercent float64) {
+	limiter := c.generator.RateLimiter()
+	return limiter.CallsPerMinute(), limiter.JitterPercent()
+}
+
+// FlowControl returns the flow control mode
+func (c *Channel) FlowControl() string {
+	return c.config.FlowControl
+}
+
+// OutputMode returns the output mode (block or stream)
+func (c *Channel) OutputMode() string {
+	return c.config.OutputMode
+}
+
 // storeRecentRecord stores a record in the circular buffer
 func (c *Channel) storeRecentRecord(data []byte, size int) {
 	c.recentMutex.Lock()
@@ -0,0 +1,209 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cdrgenerator/format"
+)
+
+// controlRequestTimeout bounds how long a control request waits for the
+// output loop, which may be busy with a slow write or a reconnect
+const controlRequestTimeout = 5 * time.Second
+
+// controlRequest is a change to a running channel, applied by the output
+// loop between records so it never races a write
+type controlRequest struct {
+	fn     func(ctx context.Context) error
+	result chan error
+}
+
+// runInLoop runs fn on the output loop and returns its result
+func (c *Channel) runInLoop(fn func(ctx context.Context) error) error {
+	req := controlRequest{
+		fn:     fn,
+		result: make(chan error, 1),
+	}
+
+	timeout := time.NewTimer(controlRequestTimeout)
+	defer timeout.Stop()
+
+	select {
+	case c.controlCh <- req:
+	case <-c.stopCh:
+		return fmt.Errorf("channel stopped")
+	case <-timeout.C:
+		return fmt.Errorf("channel busy, try again")
+	}
+
+	return <-req.result
+}
+
+// Pause stops the channel generating records until Resume is called.
+// In stream mode, lines of calls in progress are held as well.
+func (c *Channel) Pause() error {
+	return c.runInLoop(func(ctx context.Context) error {
+		if c.paused {
+			return nil
+		}
+		c.paused = true
+		c.setState(c.idleState())
+		c.logger.Info("Channel paused")
+		return nil
+	})
+}
+
+// Resume restarts a paused channel
+func (c *Channel) Resume() error {
+	return c.runInLoop(func(ctx context.Context) error {
+		if !c.paused {
+			return nil
+		}
+		c.paused = false
+		c.setState(c.idleState())
+		c.logger.Info("Channel resumed")
+		return nil
+	})
+}
+
+// SetRate changes the call rate and jitter of a running channel. The new
+// interval starts immediately.
+func (c *Channel) SetRate(callsPerMinute, jitterPercent float64) error {
+	if callsPerMinute <= 0 {
+		return fmt.Errorf("calls per minute must be greater than 0")
+	}
+	if jitterPercent < 0 || jitterPercent > 100 {
+		return fmt.Errorf("jitter percent must be between 0 and 100")
+	}
+
+	limiter := c.generator.RateLimiter()
+	oldCPM, oldJitter := limiter.CallsPerMinute(), limiter.JitterPercent()
+
+	limiter.SetCallsPerMinute(callsPerMinute)
+	limiter.SetJitterPercent(jitterPercent)
+
+	c.logger.Info("Channel rate changed",
+		"calls_per_minute", callsPerMinute,
+		"jitter_percent", jitterPercent,
+		"previous_calls_per_minute", oldCPM,
+		"previous_jitter_percent", oldJitter,
+	)
+	return nil
+}
+
+// SendNow sends the next record immediately, outside the normal schedule.
+// It works while the channel is paused, so records can be stepped through
+// one at a time. In stream mode it starts the next call, whose lines follow
+// at their event times; while paused, the whole call is written at once.
+func (c *Channel) SendNow() error {
+	return c.runInLoop(func(ctx context.Context) error {
+		if c.linkSilent() {
+			return fmt.Errorf("link fault %s in progress", c.linkFault.kind)
+		}
+
+		var err error
+		if c.config.IsStreaming() {
+			var call *streamCall
+			call, err = c.startStreamCall(ctx)
+			if call != nil && c.paused {
+				c.writeCallNow(call)
+			} else {
+				c.writeDueLines()
+			}
+		} else {
+			err = c.sendNextRecord(ctx)
+		}
+		if err != nil {
+			c.handleError(err)
+			return err
+		}
+
+		c.statsMutex.Lock()
+		c.stats.ManualSends++
+		c.statsMutex.Unlock()
+
+		c.logger.Info("Sent record on request")
+		return nil
+	})
+}
+
+// InjectCall generates a call with specific parameters, rendered in the
+// channel's format, and sends it immediately
+func (c *Channel) InjectCall(params *format.CallParams) (*format.CDRRecord, error) {
+	return c.inject(func() (*format.CDRRecord, error) {
+		return c.generator.GenerateCall(params)
+	})
+}
+
+// InjectLines sends raw lines as one record immediately, exactly as given
+// apart from the channel's framing
+func (c *Channel) InjectLines(lines []string) (*format.CDRRecord, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no lines to send")
+	}
+
+	return c.inject(func() (*format.CDRRecord, error) {
+		c.statsMutex.RLock()
+		n := c.stats.RecordsInjected + 1
+		c.statsMutex.RUnlock()
+
+		return &format.CDRRecord{
+			ID:        fmt.Sprintf("inject-%d", n),
+			Type:      "raw",
+			Timestamp: time.Now(),
+			Lines:     lines,
+		}, nil
+	})
+}
+
+// inject builds a record on the output loop and sends it whole, even in
+// stream mode or while the channel is paused
+func (c *Channel) inject(build func() (*format.CDRRecord, error)) (*format.CDRRecord, error) {
+	var record *format.CDRRecord
+	err := c.runInLoop(func(ctx context.Context) error {
+		if c.linkSilent() {
+			return fmt.Errorf("link fault %s in progress", c.linkFault.kind)
+		}
+
+		var err error
+		if record, err = build(); err != nil {
+			return err
+		}
+		if err := c.sendRecord(record); err != nil {
+			c.handleError(err)
+			return err
+		}
+
+		c.statsMutex.Lock()
+		c.stats.RecordsInjected++
+		c.statsMutex.Unlock()
+
+		c.logger.Info("Injected record on request",
+			"record_id", record.ID,
+			"type", record.Type,
+			"lines", len(record.Lines),
+		)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// idleState is the state to report when the channel is not in error
+func (c *Channel) idleState() ChannelState {
+	switch {
+	case c.schedule != nil && c.schedulePhase == phaseFinished:
+		return StateStopped
+	case c.linkSilent():
+		return StateLinkFault
+	case c.paused:
+		return StatePaused
+	case c.schedule != nil && c.schedulePhase == phaseWaiting:
+		return StateWaiting
+	default:
+		return StateRunning
+	}
+}
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"fmt"
+
+	"cdrgenerator/format"
+	"cdrgenerator/serial"
+)
+
+// deferredRecord is a record written to a port that queued it, such as a
+// batching webhook. It is accounted as sent, or as failed, once the port
+// reports the delivery of every write it took.
+type deferredRecord struct {
+	record *format.CDRRecord // nil if the record failed before it was fully written
+	data   []byte
+	faults []Fault
+
+	writes int // Queued writes not yet delivered
+	bytes  int
+	err    error
+}
+
+// deferWrite notes a write the port queued for later delivery
+func (c *Channel) deferWrite(meta serial.RecordMeta) {
+	if c.deferred == nil {
+		c.deferred = make(map[string]*deferredRecord)
+	}
+	d := c.deferred[meta.ID]
+	if d == nil {
+		d = &deferredRecord{}
+		c.deferred[meta.ID] = d
+	}
+	d.writes++
+}
+
+// deferRecord holds back the sent accounting of a record the port queued.
+// It returns false if no write of the record was queued.
+func (c *Channel) deferRecord(record *format.CDRRecord, data []byte, faults []Fault) bool {
+	d := c.deferred[record.ID]
+	if d == nil || d.record != nil {
+		return false
+	}
+	d.record, d.data, d.faults = record, data, faults
+	return true
+}
+
+// deliveriesReady returns a channel that fires when the port has reported
+// deliveries, or nil if it never queues records
+func (c *Channel) deliveriesReady() <-chan struct{} {
+	if dw, ok := serial.Unwrap(c.currentPort()).(serial.DeferredWriter); ok {
+		return dw.Ready()
+	}
+	return nil
+}
+
+// takeDeliveries accounts for the queued records the port has delivered,
+// or failed to. It runs on the output loop, or after it has exited.
+func (c *Channel) takeDeliveries() {
+	dw, ok := serial.Unwrap(c.currentPort()).(serial.DeferredWriter)
+	if !ok {
+		return
+	}
+
+	for _, delivery := range dw.Deliveries() {
+		d := c.deferred[delivery.Meta.ID]
+		if d == nil {
+			continue
+		}
+		d.writes--
+		d.bytes += delivery.Bytes
+		if delivery.Err != nil && d.err == nil {
+			d.err = delivery.Err
+		}
+		if d.writes > 0 {
+			continue
+		}
+
+		delete(c.deferred, delivery.Meta.ID)
+		switch {
+		case d.record == nil:
+			// Already counted as failed when it was written
+		case d.err != nil:
+			// Not handleError: the port reports a failed post by itself
+			// staying open, and this may run after the channel stopped
+			err := fmt.Errorf("failed to deliver record %s: %w", d.record.ID, d.err)
+			c.statsMutex.Lock()
+			c.stats.Errors++
+			c.stats.LastError = err.Error()
+			c.statsMutex.Unlock()
+			c.logger.Error("Output error", "error", err)
+		default:
+			c.recordSent(d.record, d.data, d.bytes, d.faults)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package output
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/serial"
+)
+
+// tcpDialTimeout bounds connection attempts for tcp:// devices
+const tcpDialTimeout = 5 * time.Second
+
+// openDevice opens the port described by cfg.Device, dispatching on the
+// device scheme. Plain paths are opened as real serial ports.
+func openDevice(cfg *config.PortConfig, logger *slog.Logger) (serial.Port, error) {
+	// Special case: "stdout" device for testing
+	if cfg.Device == "stdout" {
+		return serial.NewStdoutPort("stdout"), nil
+	}
+
+	// Special case: "null" device for silent testing
+	if cfg.Device == "null" || cfg.Device == "/dev/null" {
+		return serial.NewMockPort("null"), nil
+	}
+
+	// Built-in virtual serial pair for testing without hardware
+	if cfg.IsPTY() {
+		port, err := serial.OpenPTY(cfg.PTYName(), cfg.GetPTYLink())
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("PTY created",
+			"slave", port.SlavePath(),
+			"link", port.LinkPath(),
+		)
+		return port, nil
+	}
+
+	// Webhook device: each record is POSTed to the URL
+	if cfg.IsHTTP() {
+		h := cfg.HTTP
+		return serial.NewHTTPPort(serial.HTTPPortConfig{
+			URL:           cfg.Device,
+			Payload:       h.Payload,
+			Timeout:       time.Duration(h.TimeoutSec) * time.Second,
+			MaxRetries:    *h.MaxRetries,
+			RetryDelay:    time.Duration(h.RetryDelayMs) * time.Millisecond,
+			Headers:       h.Headers,
+			BatchSize:     h.BatchSize,
+			BatchInterval: time.Duration(h.BatchIntervalSec) * time.Second,
+		}), nil
+	}
+
+	// TCP device: connect to a listening collector
+	if cfg.IsTCP() {
+		port, err := serial.DialTCP(cfg.Device, tcpDialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		return port, nil
+	}
+
+	// File device: append to a capture file
+	if cfg.IsFile() {
+		path := cfg.FilePath()
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open output file %s: %w", path, err)
+		}
+		return serial.NewFilePort(cfg.Device, f), nil
+	}
+
+	port, err := serial.Open(serial.PortConfig{
+		Device:   cfg.Device,
+		BaudRate: cfg.BaudRate,
+		DataBits: cfg.DataBits,
+		StopBits: cfg.StopBits,
+		Parity:   cfg.Parity,
+
+		FlowControl: cfg.FlowControl,
+		CTSTimeout:  cfg.GetCTSTimeout(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return port, nil
+}
+
+// paceDevice wraps port so it releases bytes at the configured line rate.
+// Real serial ports are already paced by the UART, so only the
+// inter-character delay applies to them.
+func paceDevice(cfg *config.PortConfig, port serial.Port, stop <-chan struct{}, logger *slog.Logger) serial.Port {
+	pacing := serial.PacingConfig{
+		DataBits:       cfg.DataBits,
+		StopBits:       cfg.StopBits,
+		Parity:         cfg.Parity,
+		InterCharDelay: cfg.GetInterCharDelay(),
+	}
+	if _, isSerial := port.(*serial.RealPort); cfg.PaceOutput && !isSerial {
+		pacing.BaudRate = cfg.BaudRate
+	}
+
+	if pacing.BaudRate == 0 && pacing.InterCharDelay == 0 {
+		return port
+	}
+
+	paced := serial.NewPacedPort(port, pacing, stop)
+	logger.Debug("Output paced",
+		"baud_rate", pacing.BaudRate,
+		"inter_char_delay", pacing.InterCharDelay,
+		"char_time", paced.CharTime(),
+	)
+	return paced
+}
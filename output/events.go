@@ -0,0 +1,153 @@
+package output
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types
+const (
+	EventRecord = "record" // A record was sent
+	EventState  = "state"  // A channel changed state
+)
+
+// Event is something that happened on a channel, published to live
+// subscribers such as the dashboard
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Format string    `json:"format"`
+
+	// Record events
+	RecordID   string  `json:"record_id,omitempty"`
+	RecordType string  `json:"record_type,omitempty"`
+	Bytes      int     `json:"bytes,omitempty"`
+	Data       string  `json:"data,omitempty"`
+	Faults     []Fault `json:"faults,omitempty"`
+
+	// State events
+	State         string `json:"state,omitempty"`
+	PreviousState string `json:"previous_state,omitempty"`
+}
+
+// EventFilter selects the events a subscriber receives. Empty fields match
+// everything.
+type EventFilter struct {
+	Device     string
+	Format     string
+	RecordType string // Record events only; state events always match
+	Types      []string
+}
+
+// Match returns true if the filter selects e
+func (f EventFilter) Match(e Event) bool {
+	if f.Device != "" && f.Device != e.Device {
+		return false
+	}
+	if f.Format != "" && f.Format != e.Format {
+		return false
+	}
+	if f.RecordType != "" && e.Type == EventRecord && f.RecordType != e.RecordType {
+		return false
+	}
+	if len(f.Types) > 0 {
+		for _, t := range f.Types {
+			if t == e.Type {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Subscription receives events from an EventBus until unsubscribed
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	filter  EventFilter
+	dropped atomic.Int64
+}
+
+// Dropped returns the number of events not delivered because the
+// subscriber fell behind
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// EventBus fans channel events out to subscribers. Publishing never
+// blocks: a subscriber whose buffer is full misses the event.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewEventBus creates an event bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe returns a subscription receiving the events that match filter,
+// buffering up to buffer events
+func (b *EventBus) Subscribe(filter EventFilter, buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub
+}
+
+// Unsubscribe stops delivery to sub and closes its channel
+func (b *EventBus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Publish delivers e to every matching subscriber
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// publishRecord publishes a record sent on the channel
+func (c *Channel) publishRecord(id, recordType string, data []byte, n int, faults []Fault) {
+	c.events.Publish(Event{
+		Type:       EventRecord,
+		Time:       time.Now(),
+		Device:     c.config.Device,
+		Format:     c.config.Format,
+		RecordID:   id,
+		RecordType: recordType,
+		Bytes:      n,
+		Data:       string(data),
+		Faults:     faults,
+	})
+}
@@ -0,0 +1,290 @@
+package output
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/format"
+	"cdrgenerator/serial"
+)
+
+// Fault kinds
+const (
+	FaultTruncate      = "truncate"
+	FaultDropLine      = "drop_line"
+	FaultDuplicate     = "duplicate"
+	FaultGarbage       = "garbage"
+	FaultControlBytes  = "control_bytes"
+	FaultBitFlip       = "bit_flip"
+	FaultSplit         = "split"
+	FaultOmitSeparator = "omit_separator"
+)
+
+// Fault describes one fault injected into a record
+type Fault struct {
+	Kind   string `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// faultedWrite is what actually goes on the wire for one record (or line):
+// the data, optionally split into chunks with a pause between them, and
+// written more than once for duplicates
+type faultedWrite struct {
+	chunks [][]byte
+	pause  time.Duration
+	copies int
+	faults []Fault
+}
+
+// faultInjector corrupts records between the generator and the port.
+// It is only used from the channel's output loop.
+type faultInjector struct {
+	config *config.FaultConfig
+	format format.CDRFormat
+	random *rand.Rand
+	logger *slog.Logger
+
+	counts      map[string]int64
+	countsMutex sync.RWMutex
+}
+
+func newFaultInjector(cfg *config.FaultConfig, f format.CDRFormat, logger *slog.Logger) *faultInjector {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	logger.Warn("Fault injection enabled", "seed", seed)
+
+	return &faultInjector{
+		config: cfg,
+		format: f,
+		random: rand.New(rand.NewSource(seed)),
+		logger: logger,
+		counts: make(map[string]int64),
+	}
+}
+
+// hit returns true with probability p
+func (fi *faultInjector) hit(p float64) bool {
+	return p > 0 && fi.random.Float64() < p
+}
+
+// record logs and counts an injected fault
+func (fi *faultInjector) record(recordID string, fault Fault) Fault {
+	fi.countsMutex.Lock()
+	fi.counts[fault.Kind]++
+	fi.countsMutex.Unlock()
+
+	fi.logger.Info("Injected fault",
+		"record_id", recordID,
+		"fault", fault.Kind,
+		"detail", fault.Detail,
+	)
+	return fault
+}
+
+// dropLines applies the line-level faults to a record's lines before they
+// are framed. It returns the indexes of the lines to send.
+func (fi *faultInjector) dropLines(recordID string, lines []string) ([]int, []Fault) {
+	var faults []Fault
+
+	keep := make([]int, 0, len(lines))
+	for i := range lines {
+		keep = append(keep, i)
+	}
+
+	if fi.hit(fi.config.OmitSeparator) {
+		kept := keep[:0]
+		for _, i := range keep {
+			if !format.IsSeparator(fi.format, lines[i]) {
+				kept = append(kept, i)
+			}
+		}
+		if omitted := len(keep) - len(kept); omitted > 0 {
+			faults = append(faults, fi.record(recordID, Fault{
+				Kind:   FaultOmitSeparator,
+				Detail: fmt.Sprintf("removed %d separator lines", omitted),
+			}))
+		}
+		keep = kept
+	}
+
+	if len(keep) > 1 && fi.hit(fi.config.DropLine) {
+		j := fi.random.Intn(len(keep))
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultDropLine,
+			Detail: fmt.Sprintf("dropped line %d", keep[j]+1),
+		}))
+		keep = append(keep[:j], keep[j+1:]...)
+	}
+
+	return keep, faults
+}
+
+// mutateWrite applies the byte-level faults to framed data and decides how
+// it is written
+func (fi *faultInjector) mutateWrite(recordID string, data []byte) faultedWrite {
+	var faults []Fault
+	data = append([]byte(nil), data...)
+
+	if len(data) > 1 && fi.hit(fi.config.Truncate) {
+		keep := 1 + fi.random.Intn(len(data)-1)
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultTruncate,
+			Detail: fmt.Sprintf("kept %d of %d bytes", keep, len(data)),
+		}))
+		data = data[:keep]
+	}
+
+	if fi.hit(fi.config.Garbage) {
+		junk := make([]byte, 1+fi.random.Intn(16))
+		for i := range junk {
+			junk[i] = byte(0x21 + fi.random.Intn(0x7E-0x21))
+		}
+		pos := fi.random.Intn(len(data) + 1)
+		data = insertBytes(data, pos, junk)
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultGarbage,
+			Detail: fmt.Sprintf("inserted %q at byte %d", junk, pos),
+		}))
+	}
+
+	if fi.hit(fi.config.ControlBytes) {
+		ctrl := make([]byte, 1+fi.random.Intn(4))
+		for i := range ctrl {
+			// Any C0 control except LF and CR, which would just look like
+			// extra line breaks
+			b := byte(fi.random.Intn(0x20))
+			for b == '\n' || b == '\r' {
+				b = byte(fi.random.Intn(0x20))
+			}
+			ctrl[i] = b
+		}
+		pos := fi.random.Intn(len(data) + 1)
+		data = insertBytes(data, pos, ctrl)
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultControlBytes,
+			Detail: fmt.Sprintf("inserted %q at byte %d", ctrl, pos),
+		}))
+	}
+
+	if len(data) > 0 && fi.hit(fi.config.BitFlip) {
+		pos := fi.random.Intn(len(data))
+		bit := fi.random.Intn(8)
+		data[pos] ^= 1 << bit
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultBitFlip,
+			Detail: fmt.Sprintf("flipped bit %d of byte %d", bit, pos),
+		}))
+	}
+
+	w := cleanWrite(data)
+
+	if len(data) > 1 && fi.hit(fi.config.Split) {
+		at := 1 + fi.random.Intn(len(data)-1)
+		w.chunks = [][]byte{data[:at], data[at:]}
+		w.pause = fi.config.GetSplitPause()
+		faults = append(faults, fi.record(recordID, Fault{
+			Kind:   FaultSplit,
+			Detail: fmt.Sprintf("split at byte %d with %s pause", at, w.pause),
+		}))
+	}
+
+	if fi.hit(fi.config.Duplicate) {
+		w.copies = 2
+		faults = append(faults, fi.record(recordID, Fault{Kind: FaultDuplicate}))
+	}
+
+	w.faults = faults
+	return w
+}
+
+// Counts returns the number of faults injected, by kind
+func (fi *faultInjector) Counts() map[string]int64 {
+	fi.countsMutex.RLock()
+	defer fi.countsMutex.RUnlock()
+
+	counts := make(map[string]int64, len(fi.counts))
+	for kind, n := range fi.counts {
+		counts[kind] = n
+	}
+	return counts
+}
+
+func insertBytes(data []byte, pos int, insert []byte) []byte {
+	out := make([]byte, 0, len(data)+len(insert))
+	out = append(out, data[:pos]...)
+	out = append(out, insert...)
+	return append(out, data[pos:]...)
+}
+
+// applyLineFaults returns the indexes of the record lines to send, after
+// any line-level faults
+func (c *Channel) applyLineFaults(recordID string, lines []string) ([]int, []Fault) {
+	if c.faults == nil {
+		keep := make([]int, len(lines))
+		for i := range keep {
+			keep[i] = i
+		}
+		return keep, nil
+	}
+	return c.faults.dropLines(recordID, lines)
+}
+
+// applyWriteFaults returns the write plan for framed data, after any
+// byte-level faults
+func (c *Channel) applyWriteFaults(recordID string, data []byte) faultedWrite {
+	if c.faults == nil {
+		return cleanWrite(data)
+	}
+	return c.faults.mutateWrite(recordID, data)
+}
+
+// transmitFaulted writes a record as planned by the fault injector:
+// each chunk in turn with the split pause between them, once per copy
+func (c *Channel) transmitFaulted(meta serial.RecordMeta, w faultedWrite) (int, error) {
+	total := 0
+	for k := 0; k < w.copies; k++ {
+		for i, chunk := range w.chunks {
+			if i > 0 && !c.sleep(w.pause) {
+				return total, fmt.Errorf("channel stopped during split record %s", meta.ID)
+			}
+
+			// Only a complete record can be acknowledged
+			var n int
+			var err error
+			if i < len(w.chunks)-1 {
+				n, err = c.writeRecord(meta, chunk)
+			} else {
+				n, err = c.transmit(meta, chunk)
+			}
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// cleanWrite is the write plan for a record with no faults
+func cleanWrite(data []byte) faultedWrite {
+	return faultedWrite{chunks: [][]byte{data}, copies: 1}
+}
+
+// data returns the bytes of one copy of the write
+func (w faultedWrite) data() []byte {
+	if len(w.chunks) == 1 {
+		return w.chunks[0]
+	}
+	var out []byte
+	for _, chunk := range w.chunks {
+		out = append(out, chunk...)
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package output
+
+import (
+	"math/bits"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"cdrgenerator/config"
+)
+
+// asciiReplacements covers characters that do not decompose to an ASCII
+// letter plus accents
+var asciiReplacements = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Ø': "O", 'ø': "o", 'Đ': "D", 'đ': "d",
+	'Ł': "L", 'ł': "l", 'Œ': "OE", 'œ': "oe", 'Þ': "TH", 'þ': "th",
+	'‘': "'", '’': "'", '‚': "'", '“': "\"", '”': "\"", '„': "\"",
+	'–': "-", '—': "-", '…': "...", '•': "*", '°': "o", ' ': " ",
+}
+
+// framer encodes record lines into the bytes a port puts on the wire
+type framer struct {
+	lineEnding []byte
+	prefix     []byte
+	suffix     []byte
+	charset    string
+	parityBit  string
+	lineWidth  int
+}
+
+func newFramer(cfg *config.FramingConfig) *framer {
+	f := &framer{
+		lineEnding: []byte("\n"),
+		charset:    "utf8",
+		parityBit:  "none",
+	}
+	if cfg == nil {
+		return f
+	}
+
+	switch cfg.LineEnding {
+	case "crlf":
+		f.lineEnding = []byte("\r\n")
+	case "cr":
+		f.lineEnding = []byte("\r")
+	case "none":
+		f.lineEnding = nil
+	}
+
+	f.charset = cfg.Charset
+	f.parityBit = cfg.ParityBit
+	f.lineWidth = cfg.LineWidth
+	f.prefix = f.encode(cfg.RecordPrefix)
+	f.suffix = f.encode(cfg.RecordSuffix)
+	return f
+}
+
+// frameRecord encodes a complete record, wrapped in the prefix and suffix
+func (f *framer) frameRecord(lines []string) []byte {
+	var out []byte
+	for i, line := range lines {
+		out = append(out, f.frameLine(line, i == 0, i == len(lines)-1)...)
+	}
+	return out
+}
+
+// frameLine encodes one line. The record prefix goes before the first line
+// and the suffix after the last, so streamed records are framed the same
+// way as whole ones.
+func (f *framer) frameLine(line string, first, last bool) []byte {
+	var out []byte
+	if first {
+		out = append(out, f.prefix...)
+	}
+
+	out = append(out, f.encode(f.pad(line))...)
+	out = append(out, f.encode(string(f.lineEnding))...)
+
+	if last {
+		out = append(out, f.suffix...)
+	}
+	return out
+}
+
+// pad extends a line with spaces to the configured width
+func (f *framer) pad(line string) string {
+	if n := utf8.RuneCountInString(line); n < f.lineWidth {
+		return line + strings.Repeat(" ", f.lineWidth-n)
+	}
+	return line
+}
+
+// encode converts text to the configured character set and applies the
+// software parity bit
+func (f *framer) encode(text string) []byte {
+	var out []byte
+
+	switch f.charset {
+	case "ascii":
+		out = []byte(toASCII(text))
+	case "latin1":
+		out = make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xFF {
+				r = '?'
+			}
+			out = append(out, byte(r))
+		}
+	default:
+		return []byte(text)
+	}
+
+	if f.parityBit != "none" {
+		for i, b := range out {
+			out[i] = withParity(b, f.parityBit)
+		}
+	}
+	return out
+}
+
+// toASCII transliterates text to 7-bit ASCII, stripping accents and
+// replacing anything without an equivalent with '?'
+func toASCII(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// Combining accent left over from decomposition
+		default:
+			if s, ok := asciiReplacements[r]; ok {
+				b.WriteString(s)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// withParity sets bit 7 of a 7-bit character
+func withParity(b byte, parity string) byte {
+	b &= 0x7F
+	ones := bits.OnesCount8(b)
+
+	switch parity {
+	case "even":
+		if ones%2 == 1 {
+			b |= 0x80
+		}
+	case "odd":
+		if ones%2 == 0 {
+			b |= 0x80
+		}
+	case "mark":
+		b |= 0x80
+	}
+	return b
+}
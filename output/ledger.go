@@ -0,0 +1,168 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cdrgenerator/format"
+)
+
+// ErrLedgerDisabled is returned when exporting without a ledger directory
+var ErrLedgerDisabled = errors.New("ledger not enabled (set app.ledger_dir)")
+
+// LedgerEntry is one line of a channel's ledger: a record that was sent
+type LedgerEntry struct {
+	SentAt   time.Time `json:"sent_at"`
+	Device   string    `json:"device"`
+	Format   string    `json:"format"`
+	RecordID string    `json:"record_id"`
+	Type     string    `json:"type"`
+	Bytes    int       `json:"bytes"`
+	Hash     string    `json:"hash"` // See format.CDRRecord.ContentHash
+	Faults   []Fault   `json:"faults,omitempty"`
+}
+
+// ledger appends an entry for every record a channel sends to a JSONL file
+type ledger struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// openLedger opens the ledger for device in dir, appending to any entries
+// from earlier runs
+func openLedger(dir, device string) (*ledger, error) {
+	path := LedgerPath(dir, device)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	return &ledger{file: file}, nil
+}
+
+// append writes one entry as a single line
+func (l *ledger) append(entry LedgerEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(data)
+	return err
+}
+
+// Close closes the ledger file
+func (l *ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// LedgerPath returns the ledger file for device in dir. Characters that
+// are not safe in a file name are replaced, so "/dev/ttyS0" is kept in
+// "dev_ttyS0.jsonl".
+func LedgerPath(dir, device string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, device)
+	return filepath.Join(dir, strings.Trim(name, "_")+".jsonl")
+}
+
+// ExportLedger writes the ledger entries sent in [from, to) as JSONL. A
+// zero from or to leaves that end open. With an empty device the ledgers
+// of all devices in dir are exported, one after another. It returns the
+// number of entries written.
+func ExportLedger(dir, device string, from, to time.Time, w io.Writer) (int, error) {
+	var paths []string
+	if device != "" {
+		paths = []string{LedgerPath(dir, device)}
+	} else {
+		var err error
+		if paths, err = filepath.Glob(filepath.Join(dir, "*.jsonl")); err != nil {
+			return 0, err
+		}
+		sort.Strings(paths)
+	}
+
+	total := 0
+	for _, path := range paths {
+		n, err := exportLedgerFile(path, from, to, w)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func exportLedgerFile(path string, from, to time.Time, w io.Writer) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line still being written, or damaged by a crash
+			continue
+		}
+		if !from.IsZero() && entry.SentAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.SentAt.Before(to) {
+			continue
+		}
+
+		if _, err := w.Write(append(scanner.Bytes(), '\n')); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// recordLedger adds a sent record to the channel's ledger, if it has one
+func (c *Channel) recordLedger(record *format.CDRRecord, n int, faults []Fault) {
+	if c.ledger == nil {
+		return
+	}
+
+	err := c.ledger.append(LedgerEntry{
+		SentAt:   time.Now(),
+		Device:   c.config.Device,
+		Format:   c.config.Format,
+		RecordID: record.ID,
+		Type:     record.Type,
+		Bytes:    n,
+		Hash:     record.ContentHash(),
+		Faults:   faults,
+	})
+	if err != nil {
+		c.logger.Warn("Failed to write ledger entry", "record_id", record.ID, "error", err)
+	}
+}
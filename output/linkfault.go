@@ -0,0 +1,198 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/serial"
+)
+
+// Link fault kinds
+const (
+	LinkFaultDrop   = "drop"   // Close the device, as if the cable were pulled
+	LinkFaultDTR    = "dtr"    // Lower DTR
+	LinkFaultRTS    = "rts"    // Lower RTS
+	LinkFaultBreak  = "break"  // Hold the line in the break condition
+	LinkFaultSilent = "silent" // Stop transmitting with the device left open
+)
+
+// ErrLinkFaultActive is returned when a link fault is requested while
+// another is still in progress
+var ErrLinkFaultActive = errors.New("a link fault is already active")
+
+// activeLinkFault is the link fault in progress, owned by the output loop
+type activeLinkFault struct {
+	kind string
+	done <-chan time.Time // Fires when the fault's duration has passed
+
+	// A break is held by the device for its whole duration, off the loop;
+	// err is its result, set before done fires
+	err error
+}
+
+// InjectLinkFault simulates a link fault of the given kind for duration.
+// The fault is carried out by the output loop so it never races a write.
+func (c *Channel) InjectLinkFault(kind string, duration time.Duration) error {
+	if !isLinkFaultKind(kind) {
+		return fmt.Errorf("unknown link fault: %s", kind)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("link fault duration must be positive")
+	}
+
+	return c.runInLoop(func(ctx context.Context) error {
+		return c.startLinkFault(kind, duration)
+	})
+}
+
+// startLinkFault begins a link fault from the output loop
+func (c *Channel) startLinkFault(kind string, duration time.Duration) error {
+	if c.linkFault != nil {
+		return fmt.Errorf("%w: %s", ErrLinkFaultActive, c.linkFault.kind)
+	}
+
+	lines, _ := serial.Unwrap(c.port).(serial.LineController)
+
+	switch kind {
+	case LinkFaultDrop:
+		c.port.Close()
+		c.takeDeliveries()
+	case LinkFaultDTR, LinkFaultRTS, LinkFaultBreak:
+		if lines == nil {
+			return fmt.Errorf("device %s has no modem control lines", c.config.Device)
+		}
+	}
+
+	var err error
+	switch kind {
+	case LinkFaultDTR:
+		err = lines.SetDTR(false)
+	case LinkFaultRTS:
+		err = lines.SetRTS(false)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start %s link fault: %w", kind, err)
+	}
+
+	fault := &activeLinkFault{kind: kind}
+	if kind == LinkFaultBreak {
+		fault.done = c.holdBreak(lines, duration, fault)
+	} else {
+		fault.done = time.NewTimer(duration).C
+	}
+
+	c.statsMutex.Lock()
+	c.stats.LinkFaults++
+	c.stats.LinkFault = kind
+	c.stats.LinkFaultUntil = time.Now().Add(duration)
+	c.statsMutex.Unlock()
+
+	c.logger.Warn("Link fault started", "fault", kind, "duration", duration)
+
+	c.linkFault = fault
+	c.setState(c.idleState())
+	return nil
+}
+
+// holdBreak holds the line in the break condition for duration without
+// blocking the output loop. The returned channel fires once it is over;
+// Stop waits for it, so the device is not closed under the break.
+func (c *Channel) holdBreak(lines serial.LineController, duration time.Duration, fault *activeLinkFault) <-chan time.Time {
+	done := make(chan time.Time, 1)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fault.err = lines.Break(duration)
+		done <- time.Now()
+	}()
+
+	return done
+}
+
+// endLinkFault restores the link once the fault's duration has passed
+func (c *Channel) endLinkFault() {
+	fault := c.linkFault
+	c.linkFault = nil
+
+	lines, _ := serial.Unwrap(c.port).(serial.LineController)
+
+	var err error
+	switch fault.kind {
+	case LinkFaultDrop:
+		if err = c.openPort(); err != nil {
+			c.logger.Warn("Failed to reopen device after link fault", "error", err)
+			c.reconnect()
+			err = nil
+		}
+	case LinkFaultDTR:
+		err = lines.SetDTR(true)
+	case LinkFaultRTS:
+		err = lines.SetRTS(true)
+	case LinkFaultBreak:
+		err = fault.err
+	}
+	if err != nil {
+		c.handleError(fmt.Errorf("failed to end %s link fault: %w", fault.kind, err))
+	}
+
+	c.statsMutex.Lock()
+	c.stats.LinkFault = ""
+	c.stats.LinkFaultUntil = time.Time{}
+	c.statsMutex.Unlock()
+
+	c.setState(c.idleState())
+	c.logger.Info("Link fault ended", "fault", fault.kind)
+}
+
+// linkFaultDone returns a channel that fires when the active link fault
+// ends, or nil if there is none
+func (c *Channel) linkFaultDone() <-chan time.Time {
+	if c.linkFault == nil {
+		return nil
+	}
+	return c.linkFault.done
+}
+
+// linkSilent returns true while a link fault stops all transmission
+func (c *Channel) linkSilent() bool {
+	if c.linkFault == nil {
+		return false
+	}
+	switch c.linkFault.kind {
+	case LinkFaultDrop, LinkFaultSilent, LinkFaultBreak:
+		return true
+	}
+	return false
+}
+
+// runLinkFaultSchedule injects a configured link fault at its interval
+func (c *Channel) runLinkFaultSchedule(lf config.LinkFaultConfig) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(lf.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			if err := c.InjectLinkFault(lf.Kind, lf.GetDuration()); err != nil {
+				c.logger.Warn("Scheduled link fault skipped", "fault", lf.Kind, "error", err)
+			}
+		}
+	}
+}
+
+func isLinkFaultKind(kind string) bool {
+	for _, k := range config.LinkFaultKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
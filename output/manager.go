@@ -2,12 +2,15 @@ package output
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"sync"
 	"time"
 
 	"cdrgenerator/config"
+	"cdrgenerator/format"
 	"cdrgenerator/generator"
 )
 
@@ -17,6 +20,22 @@ type Manager struct {
 	channels []*Channel
 	logger   *slog.Logger
 	mu       sync.RWMutex
+
+	// Context the channels were started with, reused for channels started
+	// by a reload; nil once stopped
+	ctx context.Context
+
+	// Held for the whole of a reload, which stops and starts channels
+	// without holding mu
+	reloadMu sync.Mutex
+
+	// Records and state changes of every channel, for live subscribers
+	events *EventBus
+
+	// Saved channel state; nil when no state file is configured
+	state     *SavedState
+	stopSaver chan struct{}
+	saverWg   sync.WaitGroup
 }
 
 // NewManager creates a new output manager
@@ -25,33 +44,42 @@ func NewManager(cfg *config.Config, logger *slog.Logger) *Manager {
 		config:   cfg,
 		channels: make([]*Channel, 0),
 		logger:   logger,
+		events:   NewEventBus(),
 	}
 }
 
+// Events returns the bus carrying every channel's records and state changes
+func (m *Manager) Events() *EventBus {
+	return m.events
+}
+
 // Start initializes and starts all enabled output channels
 func (m *Manager) Start(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.ctx = ctx
+
+	if path := m.config.App.StateFile; path != "" {
+		state, err := LoadState(path)
+		if err != nil {
+			return fmt.Errorf("failed to load state file %s: %w", path, err)
+		}
+		m.state = state
+		m.logger.Info("Loaded state file", "path", path, "channels", len(state.Channels), "saved_at", state.SavedAt)
+	}
+
 	for _, portCfg := range m.config.Ports {
 		if !portCfg.Enabled {
 			m.logger.Info("Skipping disabled port", "device", portCfg.Device)
 			continue
 		}
 
-		portCfgCopy := portCfg // Create a copy for the closure
-
-		// Create generator for this port
-		gen, err := generator.New(&portCfgCopy, m.config.Timing.JitterPercent)
+		channel, err := m.startChannel(ctx, m.config, portCfg, m.savedState(portCfg.Device))
 		if err != nil {
-			return fmt.Errorf("failed to create generator for %s: %w", portCfg.Device, err)
-		}
-
-		// Create output channel
-		channel := NewChannel(&portCfgCopy, &m.config.Recovery, gen, m.logger)
-
-		// Start the channel
-		if err := channel.Start(ctx); err != nil {
+			if errors.Is(err, errGeneratorFailed) {
+				return err
+			}
 			m.logger.Error("Failed to start channel",
 				"device", portCfg.Device,
 				"error", err,
@@ -61,27 +89,82 @@ func (m *Manager) Start(ctx context.Context) error {
 		}
 
 		m.channels = append(m.channels, channel)
-		m.logger.Info("Started output channel",
-			"device", portCfg.Device,
-			"format", portCfg.Format,
-			"mode", portCfg.Mode,
-		)
 	}
 
 	if len(m.channels) == 0 {
 		return fmt.Errorf("no output channels started")
 	}
 
+	if m.state != nil {
+		m.stopSaver = make(chan struct{})
+		m.saverWg.Add(1)
+		go m.runStateSaver(m.config.App.StateFile, m.config.App.GetStateSaveInterval(), m.stopSaver)
+	}
+
 	m.logger.Info("Output manager started", "channels", len(m.channels))
 	return nil
 }
 
+// errGeneratorFailed marks a port whose records cannot be produced at all,
+// such as a missing sample file
+var errGeneratorFailed = errors.New("failed to create generator")
+
+// startChannel creates and starts the channel for one port under cfg,
+// resuming from saved if it is not nil. The channel gets its own copy of
+// the port and recovery settings.
+func (m *Manager) startChannel(ctx context.Context, cfg *config.Config, portCfg config.PortConfig, saved *SavedChannel) (*Channel, error) {
+	portCfgCopy := portCfg
+	recovery := cfg.Recovery
+
+	// Create generator for this port
+	gen, err := generator.New(&portCfgCopy, cfg.Timing.JitterPercent)
+	if err != nil {
+		return nil, fmt.Errorf("%w for %s: %w", errGeneratorFailed, portCfg.Device, err)
+	}
+
+	// Create and start the output channel
+	channel := NewChannel(&portCfgCopy, &recovery, gen, m.logger)
+	channel.events = m.events
+	if dir := cfg.App.LedgerDir; dir != "" {
+		if channel.ledger, err = openLedger(dir, portCfg.Device); err != nil {
+			return nil, err
+		}
+	}
+	if saved != nil {
+		channel.restoreState(*saved)
+	}
+	if err := channel.Start(ctx); err != nil {
+		if channel.ledger != nil {
+			channel.ledger.Close()
+		}
+		return nil, err
+	}
+
+	m.logger.Info("Started output channel",
+		"device", portCfg.Device,
+		"format", portCfg.Format,
+		"mode", portCfg.Mode,
+	)
+	return channel, nil
+}
+
 // Stop gracefully stops all output channels
 func (m *Manager) Stop() {
+	// Let a reload in progress finish, so none of its channels are missed
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// The saver takes the lock, so it must finish before we hold it
+	if m.stopSaver != nil {
+		close(m.stopSaver)
+		m.saverWg.Wait()
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.logger.Info("Stopping output manager", "channels", len(m.channels))
+	m.ctx = nil
 
 	var wg sync.WaitGroup
 	for _, channel := range m.channels {
@@ -93,6 +176,14 @@ func (m *Manager) Stop() {
 	}
 	wg.Wait()
 
+	if m.state != nil {
+		if err := m.saveStateLocked(); err != nil {
+			m.logger.Error("Failed to save state", "path", m.config.App.StateFile, "error", err)
+		} else {
+			m.logger.Info("Saved state", "path", m.config.App.StateFile)
+		}
+	}
+
 	m.logger.Info("Output manager stopped")
 }
 
@@ -116,16 +207,40 @@ func (m *Manager) GetChannelStates() map[string]ChannelInfo {
 	states := make(map[string]ChannelInfo)
 	for _, channel := range m.channels {
 		stats := channel.Stats()
+		ptySlave, ptyLink := channel.PTYPaths()
+		cpm, jitter := channel.Rate()
 		states[channel.Device()] = ChannelInfo{
 			Device:         channel.Device(),
 			Format:         channel.Format(),
 			Mode:           channel.Mode(),
 			State:          string(channel.State()),
+			CallsPerMinute: cpm,
+			JitterPercent:  jitter,
+			ManualSends:    stats.ManualSends,
+			Injected:       stats.RecordsInjected,
 			RecordsSent:    stats.RecordsSent,
 			BytesSent:      stats.BytesSent,
 			Errors:         stats.Errors,
 			LastRecordTime: stats.LastRecordTime,
 			LastError:      stats.LastError,
+			PTYSlave:       ptySlave,
+			PTYLink:        ptyLink,
+			FlowControl:    channel.FlowControl(),
+			FlowStalls:     stats.FlowControlStalls,
+			FlowStallSec:   stats.FlowControlStallTime.Seconds(),
+			FlowTimeouts:   stats.FlowControlTimeouts,
+			BytesReceived:  stats.BytesReceived,
+			AcksReceived:   stats.AcksReceived,
+			NaksReceived:   stats.NaksReceived,
+			AckTimeouts:    stats.AckTimeouts,
+			Retransmits:    stats.Retransmits,
+			OutputMode:     channel.OutputMode(),
+			ActiveCalls:    stats.ActiveCalls,
+			FaultsInjected: channel.FaultCounts(),
+			LinkFaults:     stats.LinkFaults,
+			LinkFault:      stats.LinkFault,
+			LinkFaultUntil: stats.LinkFaultUntil,
+			Tees:           channel.TeeStats(),
 		}
 	}
 	return states
@@ -133,15 +248,37 @@ func (m *Manager) GetChannelStates() map[string]ChannelInfo {
 
 // ChannelInfo contains information about a channel for external consumers
 type ChannelInfo struct {
-	Device         string    `json:"device"`
-	Format         string    `json:"format"`
-	Mode           string    `json:"mode"`
-	State          string    `json:"state"`
-	RecordsSent    int64     `json:"records_sent"`
-	BytesSent      int64     `json:"bytes_sent"`
-	Errors         int64     `json:"errors"`
-	LastRecordTime time.Time `json:"last_record_time"`
-	LastError      string    `json:"last_error,omitempty"`
+	Device         string           `json:"device"`
+	Format         string           `json:"format"`
+	Mode           string           `json:"mode"`
+	State          string           `json:"state"`
+	CallsPerMinute float64          `json:"calls_per_minute"`
+	JitterPercent  float64          `json:"jitter_percent"`
+	ManualSends    int64            `json:"manual_sends"`
+	Injected       int64            `json:"records_injected"`
+	RecordsSent    int64            `json:"records_sent"`
+	BytesSent      int64            `json:"bytes_sent"`
+	Errors         int64            `json:"errors"`
+	LastRecordTime time.Time        `json:"last_record_time"`
+	LastError      string           `json:"last_error,omitempty"`
+	PTYSlave       string           `json:"pty_slave,omitempty"`
+	PTYLink        string           `json:"pty_link,omitempty"`
+	FlowControl    string           `json:"flow_control"`
+	FlowStalls     int64            `json:"flow_stalls"`
+	FlowStallSec   float64          `json:"flow_stall_sec"`
+	FlowTimeouts   int64            `json:"flow_timeouts"`
+	BytesReceived  int64            `json:"bytes_received"`
+	AcksReceived   int64            `json:"acks_received"`
+	NaksReceived   int64            `json:"naks_received"`
+	AckTimeouts    int64            `json:"ack_timeouts"`
+	Retransmits    int64            `json:"retransmits"`
+	OutputMode     string           `json:"output_mode"`
+	ActiveCalls    int64            `json:"active_calls"`
+	FaultsInjected map[string]int64 `json:"faults_injected,omitempty"`
+	LinkFaults     int64            `json:"link_faults"`
+	LinkFault      string           `json:"link_fault,omitempty"`
+	LinkFaultUntil time.Time        `json:"link_fault_until,omitempty"`
+	Tees           []TeeStats       `json:"tees,omitempty"`
 }
 
 // ChannelCount returns the number of active channels
@@ -151,6 +288,136 @@ func (m *Manager) ChannelCount() int {
 	return len(m.channels)
 }
 
+// ErrUnknownDevice is returned when no running channel has the device
+var ErrUnknownDevice = errors.New("unknown device")
+
+// InjectLinkFault simulates a link fault on the channel for device
+func (m *Manager) InjectLinkFault(device, kind string, duration time.Duration) error {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return err
+	}
+	return channel.InjectLinkFault(kind, duration)
+}
+
+// PauseChannel pauses the channel for device
+func (m *Manager) PauseChannel(device string) error {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return err
+	}
+	return channel.Pause()
+}
+
+// ResumeChannel resumes the paused channel for device
+func (m *Manager) ResumeChannel(device string) error {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return err
+	}
+	return channel.Resume()
+}
+
+// SetChannelRate changes the call rate and jitter of the channel for device
+func (m *Manager) SetChannelRate(device string, callsPerMinute, jitterPercent float64) error {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return err
+	}
+	return channel.SetRate(callsPerMinute, jitterPercent)
+}
+
+// SendNow sends the next record on the channel for device immediately
+func (m *Manager) SendNow(device string) error {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return err
+	}
+	return channel.SendNow()
+}
+
+// InjectCall sends a call with specific parameters on a channel
+func (m *Manager) InjectCall(device string, params *format.CallParams) (*format.CDRRecord, error) {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return nil, err
+	}
+	return channel.InjectCall(params)
+}
+
+// InjectLines sends raw lines as one record on a channel
+func (m *Manager) InjectLines(device string, lines []string) (*format.CDRRecord, error) {
+	channel, err := m.findChannel(device)
+	if err != nil {
+		return nil, err
+	}
+	return channel.InjectLines(lines)
+}
+
+// WaitFinished blocks until every channel has finished its schedule and
+// returns true, or returns false when ctx is done first. Channels that
+// were stopped by a reload are not waited for.
+func (m *Manager) WaitFinished(ctx context.Context) bool {
+	for {
+		m.mu.RLock()
+		channels := append([]*Channel(nil), m.channels...)
+		m.mu.RUnlock()
+
+		for _, channel := range channels {
+			select {
+			case <-channel.Done():
+			case <-channel.stopCh:
+				// Replaced by a reload, or failed to restart
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		// Channels are also stopped on shutdown
+		if ctx.Err() != nil {
+			return false
+		}
+
+		// A reload may have replaced channels while we waited
+		m.mu.RLock()
+		same := len(channels) == len(m.channels)
+		for i := 0; same && i < len(channels); i++ {
+			same = channels[i] == m.channels[i]
+		}
+		m.mu.RUnlock()
+
+		if same {
+			return true
+		}
+	}
+}
+
+// ExportLedger writes the ledger entries for device, or all devices if
+// empty, sent in [from, to) as JSONL
+func (m *Manager) ExportLedger(device string, from, to time.Time, w io.Writer) (int, error) {
+	m.mu.RLock()
+	dir := m.config.App.LedgerDir
+	m.mu.RUnlock()
+
+	if dir == "" {
+		return 0, ErrLedgerDisabled
+	}
+	return ExportLedger(dir, device, from, to, w)
+}
+
+// findChannel returns the running channel for device
+func (m *Manager) findChannel(device string) (*Channel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, channel := range m.channels {
+		if channel.Device() == device {
+			return channel, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownDevice, device)
+}
+
 // GetRecentRecords returns recent CDR records for a specific device
 func (m *Manager) GetRecentRecords(device string, limit int) []RecentRecord {
 	m.mu.RLock()
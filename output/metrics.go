@@ -0,0 +1,180 @@
+package output
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Histogram bucket upper bounds
+var (
+	intervalBuckets  = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 120, 300}                  // Seconds
+	latencyBuckets   = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10} // Seconds
+	sizeBuckets      = []float64{128, 256, 512, 1024, 2048, 4096, 8192, 16384}                   // Bytes
+	reconnectBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}                                // Seconds
+)
+
+// Histogram counts observations into fixed buckets, in the form Prometheus
+// expects
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []int64 // Per bucket, plus one for values above the last bound
+	sum    float64
+	count  int64
+}
+
+// HistogramSnapshot is a copy of a histogram's state. Counts are
+// cumulative: Counts[i] is the number of observations <= Bounds[i].
+type HistogramSnapshot struct {
+	Bounds []float64
+	Counts []int64
+	Sum    float64
+	Count  int64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe adds one observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// Snapshot returns the current state
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]int64, len(h.bounds)),
+		Sum:    h.sum,
+		Count:  h.count,
+	}
+	var total int64
+	for i := range h.bounds {
+		total += h.counts[i]
+		s.Counts[i] = total
+	}
+	return s
+}
+
+// channelMetrics holds the detailed timing and size metrics of a channel
+type channelMetrics struct {
+	interval          *Histogram
+	writeLatency      *Histogram
+	flushLatency      *Histogram
+	recordSize        *Histogram
+	reconnectDuration *Histogram
+
+	mu                sync.Mutex
+	lastRecord        time.Time
+	reconnectAttempts int64
+	recordsByType     map[string]int64
+}
+
+func newChannelMetrics() *channelMetrics {
+	return &channelMetrics{
+		interval:          newHistogram(intervalBuckets),
+		writeLatency:      newHistogram(latencyBuckets),
+		flushLatency:      newHistogram(latencyBuckets),
+		recordSize:        newHistogram(sizeBuckets),
+		reconnectDuration: newHistogram(reconnectBuckets),
+		recordsByType:     make(map[string]int64),
+	}
+}
+
+// ChannelMetrics is a snapshot of a channel's detailed metrics
+type ChannelMetrics struct {
+	Device            string
+	Format            string
+	CallsPerMinute    float64
+	RecordInterval    HistogramSnapshot // Time between records sent
+	WriteLatency      HistogramSnapshot // Time to write a record to the port
+	FlushLatency      HistogramSnapshot // Time for the port to drain after a write
+	RecordSize        HistogramSnapshot // Bytes per record
+	ReconnectDuration HistogramSnapshot // Time from losing the port to reopening it
+	ReconnectAttempts int64
+	SkippedTicks      int64 // Ticks dropped because the channel was still busy
+	RecordsByType     map[string]int64
+}
+
+// observeRecord adds a sent record to the channel's metrics
+func (c *Channel) observeRecord(recordType string, n int) {
+	m := c.metrics
+	now := time.Now()
+
+	m.mu.Lock()
+	last := m.lastRecord
+	m.lastRecord = now
+	m.recordsByType[recordType]++
+	m.mu.Unlock()
+
+	if !last.IsZero() {
+		m.interval.Observe(now.Sub(last).Seconds())
+	}
+	m.recordSize.Observe(float64(n))
+}
+
+// countReconnectAttempt counts one attempt to reopen the port
+func (c *Channel) countReconnectAttempt() {
+	c.metrics.mu.Lock()
+	c.metrics.reconnectAttempts++
+	c.metrics.mu.Unlock()
+}
+
+// Metrics returns a snapshot of the channel's detailed metrics
+func (c *Channel) Metrics() ChannelMetrics {
+	m := c.metrics
+
+	m.mu.Lock()
+	byType := make(map[string]int64, len(m.recordsByType))
+	for t, n := range m.recordsByType {
+		byType[t] = n
+	}
+	attempts := m.reconnectAttempts
+	m.mu.Unlock()
+
+	var skipped int64
+	if c.ticker != nil {
+		skipped = c.ticker.Skipped()
+	}
+	cpm, _ := c.Rate()
+
+	return ChannelMetrics{
+		Device:            c.config.Device,
+		Format:            c.config.Format,
+		CallsPerMinute:    cpm,
+		RecordInterval:    m.interval.Snapshot(),
+		WriteLatency:      m.writeLatency.Snapshot(),
+		FlushLatency:      m.flushLatency.Snapshot(),
+		RecordSize:        m.recordSize.Snapshot(),
+		ReconnectDuration: m.reconnectDuration.Snapshot(),
+		ReconnectAttempts: attempts,
+		SkippedTicks:      skipped,
+		RecordsByType:     byType,
+	}
+}
+
+// GetChannelMetrics returns the detailed metrics of every channel, by device
+func (m *Manager) GetChannelMetrics() map[string]ChannelMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	metrics := make(map[string]ChannelMetrics, len(m.channels))
+	for _, channel := range m.channels {
+		metrics[channel.Device()] = channel.Metrics()
+	}
+	return metrics
+}
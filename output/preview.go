@@ -0,0 +1,67 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/generator"
+)
+
+// PreviewRecord is a record a port would send, as shown by a preview
+type PreviewRecord struct {
+	RecordID  string    `json:"record_id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Lines     []string  `json:"lines"`
+	Bytes     int       `json:"bytes"`
+	Data      string    `json:"data"` // As written to the port, with framing applied
+}
+
+// Preview returns the next count records a channel for port would send
+// when started, without opening its device. The records come from the
+// same generator a channel uses, resumed from stateFile as a channel would
+// be if it names one. Faults are not applied, as they are random. A replay
+// port that does not loop returns fewer records if its sample file runs
+// out first.
+func Preview(port *config.PortConfig, count int, stateFile string) ([]PreviewRecord, error) {
+	gen, err := generator.New(port, 0)
+	if err != nil {
+		return nil, err
+	}
+	if stateFile != "" {
+		state, err := LoadState(stateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load state file %s: %w", stateFile, err)
+		}
+		if saved, ok := state.Channels[port.Device]; ok {
+			// A position saved for other settings is ignored, as by a channel
+			gen.Restore(saved.Generator)
+		}
+	}
+	framer := newFramer(port.Framing)
+
+	records := make([]PreviewRecord, 0, count)
+	for len(records) < count {
+		record, err := gen.NextRecord(context.Background())
+		if errors.Is(err, generator.ErrSampleEnd) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data := framer.frameRecord(record.Lines)
+		records = append(records, PreviewRecord{
+			RecordID:  record.ID,
+			Type:      record.Type,
+			Timestamp: record.Timestamp,
+			Lines:     record.Lines,
+			Bytes:     len(data),
+			Data:      string(data),
+		})
+	}
+	return records, nil
+}
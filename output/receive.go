@@ -0,0 +1,177 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"cdrgenerator/serial"
+)
+
+// receiveRetryDelay is how long the receive loop waits after a read error or
+// while the port is unavailable
+const receiveRetryDelay = 500 * time.Millisecond
+
+// receiveLoop reads bytes sent back by the collector, logs and counts them,
+// and forwards ACK/NAK characters to a waiting transmit
+func (c *Channel) receiveLoop() {
+	defer c.rxWg.Done()
+
+	buf := make([]byte, 256)
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		default:
+		}
+
+		port := c.currentPort()
+		reader, ok := serial.Unwrap(port).(io.Reader)
+		if !ok || !port.IsOpen() {
+			if !c.sleep(receiveRetryDelay) {
+				return
+			}
+			continue
+		}
+
+		n, err := reader.Read(buf)
+		if err != nil {
+			select {
+			case <-c.stopCh:
+				return
+			default:
+			}
+			c.logger.Debug("Receive error", "error", err)
+			if !c.sleep(receiveRetryDelay) {
+				return
+			}
+			continue
+		}
+
+		if n > 0 {
+			c.handleReceived(buf[:n])
+		}
+	}
+}
+
+func (c *Channel) handleReceived(data []byte) {
+	recv := c.config.Receive
+
+	var acks, naks int64
+	for _, b := range data {
+		switch b {
+		case recv.AckChar[0]:
+			acks++
+			c.signalAck(true)
+		case recv.NakChar[0]:
+			naks++
+			c.signalAck(false)
+		}
+	}
+
+	c.statsMutex.Lock()
+	c.stats.BytesReceived += int64(len(data))
+	c.stats.AcksReceived += acks
+	c.stats.NaksReceived += naks
+	c.stats.LastReceiveTime = time.Now()
+	c.statsMutex.Unlock()
+
+	if recv.LogData {
+		c.logger.Info("Received data", "bytes", len(data), "data", fmt.Sprintf("%q", data))
+	} else {
+		c.logger.Debug("Received data", "bytes", len(data), "acks", acks, "naks", naks)
+	}
+}
+
+// signalAck hands an ACK or NAK to transmit without blocking the receiver
+func (c *Channel) signalAck(ack bool) {
+	select {
+	case c.ackCh <- ack:
+	default:
+	}
+}
+
+// ackRequired returns true if records must be acknowledged by the collector
+func (c *Channel) ackRequired() bool {
+	return c.receiving && c.config.Receive.AckRequired
+}
+
+// transmit writes a record to the primary port. In ACK-required mode the
+// record is retransmitted until the collector acknowledges it or the
+// retransmit limit is reached.
+func (c *Channel) transmit(meta serial.RecordMeta, data []byte) (int, error) {
+	if !c.ackRequired() {
+		return c.writeRecord(meta, data)
+	}
+
+	// Discard responses that arrived between records
+	for len(c.ackCh) > 0 {
+		<-c.ackCh
+	}
+
+	recv := c.config.Receive
+	total := 0
+
+	for attempt := 0; ; attempt++ {
+		n, err := c.writeRecord(meta, data)
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		reason, acked := c.waitForAck()
+		if acked {
+			return total, nil
+		}
+		if reason == "stopped" {
+			return total, fmt.Errorf("channel stopped before record %s was acknowledged", meta.ID)
+		}
+
+		if attempt >= *recv.MaxRetransmits {
+			return total, fmt.Errorf("record %s not acknowledged after %d retransmits (%s)",
+				meta.ID, attempt, reason)
+		}
+
+		c.statsMutex.Lock()
+		c.stats.Retransmits++
+		c.statsMutex.Unlock()
+
+		c.logger.Warn("Retransmitting record",
+			"record_id", meta.ID,
+			"attempt", attempt+1,
+			"reason", reason,
+		)
+	}
+}
+
+// waitForAck waits for the collector's response to the last write
+func (c *Channel) waitForAck() (string, bool) {
+	timer := time.NewTimer(c.config.Receive.GetAckTimeout())
+	defer timer.Stop()
+
+	select {
+	case ack := <-c.ackCh:
+		if ack {
+			return "ack", true
+		}
+		return "nak", false
+	case <-timer.C:
+		c.statsMutex.Lock()
+		c.stats.AckTimeouts++
+		c.statsMutex.Unlock()
+		return "timeout", false
+	case <-c.stopCh:
+		return "stopped", false
+	}
+}
+
+// sleep waits for d, returning false if the channel is stopped first
+func (c *Channel) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-c.stopCh:
+		return false
+	}
+}
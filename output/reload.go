@@ -0,0 +1,211 @@
+package output
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"cdrgenerator/config"
+)
+
+// ReloadResult lists what a configuration reload did to each channel
+type ReloadResult struct {
+	Started   []string `json:"started"`   // New or newly enabled ports
+	Stopped   []string `json:"stopped"`   // Removed or disabled ports
+	Restarted []string `json:"restarted"` // Ports whose settings changed
+	Updated   []string `json:"updated"`   // Rate or jitter changed in place
+	Unchanged []string `json:"unchanged"`
+	Failed    []string `json:"failed,omitempty"` // Ports that could not be started
+
+	// Sections that only take effect after a restart of the process
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// ApplyConfig brings the running channels in line with cfg, matching ports
+// by device. Channels whose settings are unchanged keep running untouched,
+// a change to only the call rate or jitter is applied in place, and any
+// other change restarts that channel alone. A change to the recovery
+// settings restarts every channel, as each holds its own copy. A channel
+// that fails to restart stays listed in error, and is tried again by the
+// next reload. Sections that need a restart of the process keep their
+// current settings; cfg itself is not modified.
+func (m *Manager) ApplyConfig(cfg *config.Config) (*ReloadResult, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// Channels are stopped and started without holding m.mu, so status,
+	// metrics and the state saver are not held up by a slow device
+	m.mu.RLock()
+	ctx := m.ctx
+	current := m.config
+	channels := append([]*Channel(nil), m.channels...)
+	m.mu.RUnlock()
+
+	if ctx == nil {
+		return nil, fmt.Errorf("output manager not running")
+	}
+
+	merged := *cfg
+	merged.App = current.App
+	merged.Logging = current.Logging
+	merged.Monitoring = current.Monitoring
+	merged.Slack = current.Slack
+	merged.Timing.StartupDelaySec = current.Timing.StartupDelaySec
+
+	result := &ReloadResult{
+		RestartRequired: restartRequired(current, cfg),
+	}
+
+	oldPorts := make(map[string]config.PortConfig)
+	for _, port := range current.Ports {
+		oldPorts[port.Device] = port
+	}
+	newPorts := make(map[string]config.PortConfig)
+	for _, port := range merged.Ports {
+		if port.Enabled {
+			newPorts[port.Device] = port
+		}
+	}
+
+	jitterChanged := merged.Timing.JitterPercent != current.Timing.JitterPercent
+	recoveryChanged := !reflect.DeepEqual(merged.Recovery, current.Recovery)
+
+	// Stop, update or restart the running channels
+	running := make(map[string]bool)
+	var kept []*Channel
+	for _, channel := range channels {
+		device := channel.Device()
+		newPort, ok := newPorts[device]
+		restart := recoveryChanged || channel.stopped()
+
+		switch {
+		case !ok:
+			channel.Stop()
+			m.rememberState(channel)
+			result.Stopped = append(result.Stopped, device)
+			m.logger.Info("Stopped output channel removed from config", "device", device)
+			continue
+
+		case !restart && samePort(oldPorts[device], newPort):
+			if jitterChanged {
+				cpm, _ := channel.Rate()
+				channel.SetRate(cpm, merged.Timing.JitterPercent)
+				result.Updated = append(result.Updated, device)
+			} else {
+				result.Unchanged = append(result.Unchanged, device)
+			}
+
+		case !restart && sameExceptRate(oldPorts[device], newPort):
+			if err := channel.SetRate(newPort.CallsPerMinute, merged.Timing.JitterPercent); err != nil {
+				m.logger.Warn("Failed to update channel rate", "device", device, "error", err)
+			}
+			result.Updated = append(result.Updated, device)
+
+		default:
+			if !channel.stopped() {
+				channel.Stop()
+				m.rememberState(channel)
+			}
+			replacement, err := m.reloadChannel(ctx, &merged, newPort)
+			if err != nil {
+				m.logger.Error("Failed to restart channel", "device", device, "error", err)
+				// Keep reporting the stopped channel, so the port does not
+				// vanish from status and metrics
+				channel.markFailed(err)
+				result.Failed = append(result.Failed, device)
+				running[device] = true
+				kept = append(kept, channel)
+				continue
+			}
+			channel = replacement
+			result.Restarted = append(result.Restarted, device)
+		}
+
+		running[device] = true
+		kept = append(kept, channel)
+	}
+
+	// Start ports that were not running, in config order
+	for _, port := range merged.Ports {
+		if !port.Enabled || running[port.Device] {
+			continue
+		}
+
+		channel, err := m.reloadChannel(ctx, &merged, port)
+		if err != nil {
+			m.logger.Error("Failed to start channel", "device", port.Device, "error", err)
+			result.Failed = append(result.Failed, port.Device)
+			continue
+		}
+		kept = append(kept, channel)
+		result.Started = append(result.Started, port.Device)
+	}
+
+	m.mu.Lock()
+	m.config = &merged
+	m.channels = kept
+	m.mu.Unlock()
+
+	m.logger.Info("Configuration applied",
+		"started", len(result.Started),
+		"stopped", len(result.Stopped),
+		"restarted", len(result.Restarted),
+		"updated", len(result.Updated),
+		"unchanged", len(result.Unchanged),
+		"failed", len(result.Failed),
+	)
+	if len(result.RestartRequired) > 0 {
+		m.logger.Warn("Some settings only take effect after a restart",
+			"sections", result.RestartRequired,
+		)
+	}
+
+	return result, nil
+}
+
+// reloadChannel starts a port's channel during a reload, resuming from its
+// saved state if there is one
+func (m *Manager) reloadChannel(ctx context.Context, cfg *config.Config, port config.PortConfig) (*Channel, error) {
+	m.mu.RLock()
+	saved := m.savedState(port.Device)
+	m.mu.RUnlock()
+
+	return m.startChannel(ctx, cfg, port, saved)
+}
+
+// samePort returns true if a port's settings are identical
+func samePort(a, b config.PortConfig) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// sameExceptRate returns true if two port settings differ only in their
+// call rate
+func sameExceptRate(a, b config.PortConfig) bool {
+	a.CallsPerMinute = b.CallsPerMinute
+	return reflect.DeepEqual(a, b)
+}
+
+// restartRequired lists the top-level sections that changed but cannot be
+// applied to a running process
+func restartRequired(old, new *config.Config) []string {
+	var sections []string
+	if !reflect.DeepEqual(old.App, new.App) {
+		sections = append(sections, "app")
+	}
+	if !reflect.DeepEqual(old.Logging, new.Logging) {
+		sections = append(sections, "logging")
+	}
+	if !reflect.DeepEqual(old.Monitoring, new.Monitoring) {
+		sections = append(sections, "monitoring")
+	}
+	if !reflect.DeepEqual(old.Slack, new.Slack) {
+		sections = append(sections, "slack")
+	}
+	// Jitter is applied in place; the startup delay only applies at start
+	oldTiming := old.Timing
+	oldTiming.JitterPercent = new.Timing.JitterPercent
+	if oldTiming != new.Timing {
+		sections = append(sections, "timing")
+	}
+	return sections
+}
@@ -0,0 +1,238 @@
+package output
+
+import (
+	"strings"
+	"time"
+
+	"cdrgenerator/config"
+)
+
+// schedulePhase is where a channel is in its schedule
+type schedulePhase int
+
+const (
+	phaseWaiting  schedulePhase = iota // Before the start or outside a window
+	phaseActive                        // Sending records
+	phaseFinished                      // Past the end; never sends again
+)
+
+// runSchedule decides when a channel sends records. It is only used from
+// the channel's output loop.
+type runSchedule struct {
+	config  *config.ScheduleConfig
+	startAt time.Time // Zero means start straight away
+	endAt   time.Time // Zero means no end time
+	windows []scheduleWindow
+	records int64 // Records sent on schedule so far
+}
+
+// scheduleWindow is a parsed WindowConfig
+type scheduleWindow struct {
+	days       map[time.Weekday]bool // Empty means every day
+	start, end time.Duration         // Offsets from midnight
+}
+
+// newRunSchedule resolves a schedule's times relative to now. The config
+// has already been validated.
+func newRunSchedule(cfg *config.ScheduleConfig, now time.Time) *runSchedule {
+	s := &runSchedule{config: cfg}
+
+	if cfg.StartAt != "" {
+		s.startAt, _ = config.ParseScheduleTime(cfg.StartAt, now)
+	}
+
+	start := now
+	if !s.startAt.IsZero() {
+		start = s.startAt
+	}
+	if cfg.StopAt != "" {
+		s.endAt, _ = config.ParseScheduleTime(cfg.StopAt, start)
+	}
+	if cfg.MaxDurationSec > 0 {
+		if end := start.Add(cfg.GetMaxDuration()); s.endAt.IsZero() || end.Before(s.endAt) {
+			s.endAt = end
+		}
+	}
+
+	for _, w := range cfg.Windows {
+		window := scheduleWindow{days: make(map[time.Weekday]bool)}
+		for _, day := range w.Days {
+			window.days[config.ScheduleDays[strings.ToLower(day)]] = true
+		}
+		window.start, _ = config.ParseTimeOfDay(w.Start)
+		window.end, _ = config.ParseTimeOfDay(w.End)
+		s.windows = append(s.windows, window)
+	}
+
+	return s
+}
+
+// phase returns where the schedule is at now
+func (s *runSchedule) phase(now time.Time) schedulePhase {
+	switch {
+	case s.config.MaxRecords > 0 && s.records >= s.config.MaxRecords:
+		return phaseFinished
+	case !s.endAt.IsZero() && !now.Before(s.endAt):
+		return phaseFinished
+	case now.Before(s.startAt):
+		return phaseWaiting
+	case len(s.windows) > 0 && !s.inWindow(now):
+		return phaseWaiting
+	default:
+		return phaseActive
+	}
+}
+
+// next returns the next time the phase may change, or zero if it will
+// only change when records are sent
+func (s *runSchedule) next(now time.Time) time.Time {
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	consider(s.startAt)
+	consider(s.endAt)
+
+	// A window that started yesterday may still be open, and the next
+	// one may be up to a week away
+	for offset := -1; offset <= 7; offset++ {
+		day := now.AddDate(0, 0, offset)
+		for _, w := range s.windows {
+			if w.allows(day) {
+				start, end := w.on(day)
+				consider(start)
+				consider(end)
+			}
+		}
+	}
+
+	return next
+}
+
+// inWindow returns true if now is inside any window
+func (s *runSchedule) inWindow(now time.Time) bool {
+	for offset := -1; offset <= 0; offset++ {
+		day := now.AddDate(0, 0, offset)
+		for _, w := range s.windows {
+			if !w.allows(day) {
+				continue
+			}
+			start, end := w.on(day)
+			if !now.Before(start) && now.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allows returns true if the window opens on day
+func (w scheduleWindow) allows(day time.Time) bool {
+	return len(w.days) == 0 || w.days[day.Weekday()]
+}
+
+// on returns when the window opening on day starts and ends. A window
+// whose end is at or before its start closes the next day.
+func (w scheduleWindow) on(day time.Time) (time.Time, time.Time) {
+	start := config.AtTimeOfDay(day, w.start)
+	end := config.AtTimeOfDay(day, w.end)
+	if !end.After(start) {
+		end = config.AtTimeOfDay(day.AddDate(0, 0, 1), w.end)
+	}
+	return start, end
+}
+
+// scheduleActive returns true if the channel may send a record on schedule
+func (c *Channel) scheduleActive() bool {
+	return c.schedule == nil || c.schedulePhase == phaseActive
+}
+
+// scheduleDue returns a channel that fires at the next schedule change, or
+// nil if there is none
+func (c *Channel) scheduleDue() <-chan time.Time {
+	if c.scheduleTimer == nil {
+		return nil
+	}
+	return c.scheduleTimer.C
+}
+
+// updateSchedule moves the channel to its current schedule phase and sets
+// the timer for the next change
+func (c *Channel) updateSchedule() {
+	if c.schedule == nil || c.schedulePhase == phaseFinished {
+		return
+	}
+
+	now := time.Now()
+	phase := c.schedule.phase(now)
+
+	if c.scheduleTimer != nil {
+		c.scheduleTimer.Stop()
+		c.scheduleTimer = nil
+	}
+	if phase != phaseFinished {
+		if next := c.schedule.next(now); !next.IsZero() {
+			c.scheduleTimer = time.NewTimer(next.Sub(now))
+		}
+	}
+
+	if phase == c.schedulePhase {
+		return
+	}
+	c.schedulePhase = phase
+
+	switch phase {
+	case phaseWaiting:
+		c.logger.Info("Channel waiting for schedule", "until", c.schedule.next(now))
+	case phaseActive:
+		c.logger.Info("Channel schedule active")
+	case phaseFinished:
+		c.logger.Info("Channel schedule finished", "scheduled_records", c.schedule.records)
+	}
+
+	c.setState(c.idleState())
+	c.checkFinished()
+}
+
+// countScheduledRecord counts a record sent on schedule toward max_records
+func (c *Channel) countScheduledRecord() {
+	if c.schedule == nil {
+		return
+	}
+	c.schedule.records++
+	if c.schedule.config.MaxRecords > 0 && c.schedule.records >= c.schedule.config.MaxRecords {
+		c.updateSchedule()
+	}
+}
+
+// checkFinished marks the channel done once its schedule has finished and,
+// in stream mode, the last call in progress has been written
+func (c *Channel) checkFinished() {
+	if c.schedulePhase != phaseFinished || c.streamQueue.Len() > 0 {
+		return
+	}
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	stats := c.Stats()
+	c.logger.Info("Channel finished",
+		"records_sent", stats.RecordsSent,
+		"bytes_sent", stats.BytesSent,
+		"errors", stats.Errors,
+		"runtime", time.Since(stats.StartTime).Round(time.Second),
+	)
+	close(c.done)
+}
+
+// Done returns a channel that is closed when the channel's schedule has
+// finished. Channels without a finite schedule never finish.
+func (c *Channel) Done() <-chan struct{} {
+	return c.done
+}
@@ -0,0 +1,160 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/generator"
+)
+
+// SavedState is the contents of the state file: where each channel was in
+// its sequence of records, and its totals so far
+type SavedState struct {
+	SavedAt  time.Time               `json:"saved_at"`
+	Channels map[string]SavedChannel `json:"channels"` // By device
+}
+
+// SavedChannel is the saved state of one channel
+type SavedChannel struct {
+	Generator       generator.State `json:"generator"`
+	RecordsSent     int64           `json:"records_sent"`
+	BytesSent       int64           `json:"bytes_sent"`
+	Errors          int64           `json:"errors"`
+	ManualSends     int64           `json:"manual_sends"`
+	RecordsInjected int64           `json:"records_injected"`
+}
+
+// LoadState reads a state file. A missing file is not an error; it
+// returns an empty state.
+func LoadState(path string) (*SavedState, error) {
+	state := &SavedState{Channels: make(map[string]SavedChannel)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	if state.Channels == nil {
+		state.Channels = make(map[string]SavedChannel)
+	}
+	return state, nil
+}
+
+// Save writes the state file atomically, so a crash mid-write leaves the
+// previous state intact
+func (s *SavedState) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFile(path, data, 0644)
+}
+
+// SavedState returns the channel's state for the state file
+func (c *Channel) SavedState() SavedChannel {
+	stats := c.Stats()
+	return SavedChannel{
+		Generator:       c.generator.State(),
+		RecordsSent:     stats.RecordsSent,
+		BytesSent:       stats.BytesSent,
+		Errors:          stats.Errors,
+		ManualSends:     stats.ManualSends,
+		RecordsInjected: stats.RecordsInjected,
+	}
+}
+
+// restoreState resumes a channel from its saved state before it starts.
+// Totals always carry over; the generator position only if the format,
+// mode and sample file are unchanged.
+func (c *Channel) restoreState(saved SavedChannel) {
+	c.statsMutex.Lock()
+	c.stats.RecordsSent = saved.RecordsSent
+	c.stats.BytesSent = saved.BytesSent
+	c.stats.Errors = saved.Errors
+	c.stats.ManualSends = saved.ManualSends
+	c.stats.RecordsInjected = saved.RecordsInjected
+	c.statsMutex.Unlock()
+
+	if err := c.generator.Restore(saved.Generator); err != nil {
+		c.logger.Warn("Not resuming generator position", "reason", err)
+		return
+	}
+
+	c.logger.Info("Resumed from saved state",
+		"replay_index", saved.Generator.ReplayIndex,
+		"loops", saved.Generator.Loops,
+		"call_number", saved.Generator.CallNumber,
+		"records_sent", saved.RecordsSent,
+	)
+}
+
+// saveState writes the state of every channel to the state file. Channels
+// no longer running keep the state they had when they stopped.
+func (m *Manager) saveState() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.saveStateLocked()
+}
+
+// saveStateLocked is saveState for callers already holding m.mu
+func (m *Manager) saveStateLocked() error {
+	for _, channel := range m.channels {
+		m.state.Channels[channel.Device()] = channel.SavedState()
+	}
+	m.state.SavedAt = time.Now()
+	return m.state.Save(m.config.App.StateFile)
+}
+
+// rememberState keeps the state of a channel that has stopped, so it
+// resumes from there if started again
+func (m *Manager) rememberState(channel *Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.state != nil {
+		m.state.Channels[channel.Device()] = channel.SavedState()
+	}
+}
+
+// savedState returns the saved state of a port's channel, or nil if there
+// is none. Callers hold m.mu.
+func (m *Manager) savedState(device string) *SavedChannel {
+	if m.state == nil {
+		return nil
+	}
+	saved, ok := m.state.Channels[device]
+	if !ok {
+		return nil
+	}
+	return &saved
+}
+
+// runStateSaver saves the state file at the configured interval
+func (m *Manager) runStateSaver(path string, interval time.Duration, stop <-chan struct{}) {
+	defer m.saverWg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.saveState(); err != nil {
+				m.logger.Warn("Failed to save state", "path", path, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package output
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cdrgenerator/format"
+	"cdrgenerator/serial"
+)
+
+// streamCall is a record whose lines are being written as its events happen
+type streamCall struct {
+	record    *format.CDRRecord
+	lines     int
+	remaining int
+	bytes     int
+	data      []byte  // Everything written so far, for the recent records buffer
+	faults    []Fault // Faults injected into any of the call's lines
+	failed    bool    // A line failed to write, so the call is not sent whole
+}
+
+// streamLine is one pending line of an in-progress call
+type streamLine struct {
+	due  time.Time
+	seq  int64 // Keeps lines due at the same instant in the order they were queued
+	call *streamCall
+	text string
+}
+
+// streamQueue is a min-heap of pending lines across all in-progress calls,
+// ordered by due time. Lines of overlapping calls interleave naturally.
+type streamQueue []*streamLine
+
+func (q streamQueue) Len() int { return len(q) }
+
+func (q streamQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q streamQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *streamQueue) Push(x interface{}) { *q = append(*q, x.(*streamLine)) }
+
+func (q *streamQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
+
+// startStreamCall fetches the next record and schedules each of its lines
+// at its simulated event time. The call is nil if faults dropped every line.
+func (c *Channel) startStreamCall(ctx context.Context) (*streamCall, error) {
+	record, err := c.generator.NextRecord(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next record: %w", err)
+	}
+
+	lines := format.StreamLines(c.generator.Format(), record)
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	keep, faults := c.applyLineFaults(record.ID, texts)
+	if len(keep) < len(lines) {
+		kept := make([]format.StreamLine, len(keep))
+		for i, j := range keep {
+			kept[i] = lines[j]
+		}
+		lines = kept
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	call := &streamCall{
+		record:    record,
+		lines:     len(lines),
+		remaining: len(lines),
+		faults:    faults,
+	}
+
+	now := time.Now()
+	for _, line := range lines {
+		c.streamSeq++
+		heap.Push(&c.streamQueue, &streamLine{
+			due:  now.Add(time.Duration(float64(line.Offset) / c.config.StreamSpeedup)),
+			seq:  c.streamSeq,
+			call: call,
+			text: line.Text,
+		})
+	}
+
+	c.statsMutex.Lock()
+	c.stats.ActiveCalls++
+	c.statsMutex.Unlock()
+
+	c.logger.Debug("Call started",
+		"record_id", record.ID,
+		"lines", len(lines),
+		"duration", lines[len(lines)-1].Offset,
+	)
+
+	return call, nil
+}
+
+// writeDueLines writes every pending line whose event time has passed
+func (c *Channel) writeDueLines() {
+	now := time.Now()
+	for c.streamQueue.Len() > 0 && !c.streamQueue[0].due.After(now) {
+		line := heap.Pop(&c.streamQueue).(*streamLine)
+		if err := c.writeStreamLine(line); err != nil {
+			c.handleError(err)
+		}
+	}
+}
+
+// writeCallNow writes every pending line of a call at once, in order,
+// without waiting for their event times
+func (c *Channel) writeCallNow(call *streamCall) {
+	var lines streamQueue
+	rest := c.streamQueue[:0]
+	for _, line := range c.streamQueue {
+		if line.call == call {
+			lines = append(lines, line)
+		} else {
+			rest = append(rest, line)
+		}
+	}
+	c.streamQueue = rest
+	heap.Init(&c.streamQueue)
+
+	sort.Sort(lines)
+	for _, line := range lines {
+		if err := c.writeStreamLine(line); err != nil {
+			c.handleError(err)
+		}
+	}
+}
+
+// nextStreamDue returns a channel that fires when the next line is due, or
+// nil if nothing is pending. Lines are held while the channel is paused or
+// a link fault silences it.
+func (c *Channel) nextStreamDue() <-chan time.Time {
+	if c.streamQueue.Len() == 0 || c.paused || c.linkSilent() {
+		return nil
+	}
+
+	wait := time.Until(c.streamQueue[0].due)
+	if c.streamTimer == nil {
+		c.streamTimer = time.NewTimer(wait)
+		return c.streamTimer.C
+	}
+	// Drain a tick that fired while another case was chosen, so Reset
+	// starts clean
+	if !c.streamTimer.Stop() {
+		select {
+		case <-c.streamTimer.C:
+		default:
+		}
+	}
+	c.streamTimer.Reset(wait)
+	return c.streamTimer.C
+}
+
+func (c *Channel) writeStreamLine(line *streamLine) error {
+	call := line.call
+	first := call.remaining == call.lines
+	call.remaining--
+
+	w := c.applyWriteFaults(call.record.ID, c.framer.frameLine(line.text, first, call.remaining == 0))
+	call.faults = append(call.faults, w.faults...)
+	data := w.data()
+	meta := serial.RecordMeta{
+		ID:        call.record.ID,
+		Type:      call.record.Type,
+		Timestamp: time.Now(),
+		Format:    c.config.Format,
+		Lines:     []string{line.text},
+	}
+
+	for _, tee := range c.tees {
+		tee.enqueue(meta, data)
+	}
+
+	n, err := c.transmitFaulted(meta, w)
+	if err != nil {
+		call.failed = true
+	} else {
+		call.bytes += n
+		call.data = append(call.data, data...)
+
+		c.statsMutex.Lock()
+		c.stats.BytesSent += int64(n)
+		c.statsMutex.Unlock()
+	}
+
+	if call.remaining == 0 {
+		c.finishStreamCall(call)
+	}
+
+	return err
+}
+
+// finishStreamCall accounts for a call once its last line has been written.
+// Like a record in block mode, a call with a failed write is not counted
+// or ledgered as sent; its errors have been counted already.
+func (c *Channel) finishStreamCall(call *streamCall) {
+	if call.failed {
+		c.statsMutex.Lock()
+		c.stats.ActiveCalls--
+		c.statsMutex.Unlock()
+
+		c.logger.Warn("Call not sent whole",
+			"record_id", call.record.ID,
+			"bytes", call.bytes,
+		)
+		return
+	}
+
+	c.statsMutex.Lock()
+	c.stats.ActiveCalls--
+	c.stats.RecordsSent++
+	c.stats.LastRecordTime = time.Now()
+	c.statsMutex.Unlock()
+
+	c.storeRecentRecord(call.data, call.bytes)
+	c.publishRecord(call.record.ID, call.record.Type, call.data, call.bytes, call.faults)
+	c.recordLedger(call.record, call.bytes, call.faults)
+	c.observeRecord(call.record.Type, call.bytes)
+	c.portStats.RecordSent()
+
+	c.logger.Debug("Sent record",
+		"record_id", call.record.ID,
+		"bytes", call.bytes,
+		"faults", len(call.faults),
+	)
+}
+
+// discardStreamLines drops the lines of calls still in progress, and stops
+// the line timer, when the output loop exits
+func (c *Channel) discardStreamLines() {
+	if c.streamTimer != nil {
+		c.streamTimer.Stop()
+	}
+	if c.streamQueue.Len() == 0 {
+		return
+	}
+
+	c.statsMutex.Lock()
+	calls := c.stats.ActiveCalls
+	c.stats.ActiveCalls = 0
+	c.statsMutex.Unlock()
+
+	c.logger.Info("Discarded unfinished calls",
+		"calls", calls,
+		"lines", c.streamQueue.Len(),
+	)
+	c.streamQueue = nil
+}
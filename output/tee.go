@@ -0,0 +1,239 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cdrgenerator/config"
+	"cdrgenerator/serial"
+)
+
+// teeOutput delivers a copy of a channel's records to one extra device.
+// Each tee has its own queue, goroutine and reconnect handling so a slow or
+// broken device never blocks the primary port or the other tees.
+type teeOutput struct {
+	config   config.PortConfig
+	recovery *config.RecoveryConfig
+	port     serial.Port
+	logger   *slog.Logger
+
+	queue chan teeItem
+
+	stats      TeeStats
+	statsMutex sync.RWMutex
+
+	wg sync.WaitGroup
+}
+
+type teeItem struct {
+	meta serial.RecordMeta
+	data []byte
+}
+
+// TeeStats contains statistics for a tee device
+type TeeStats struct {
+	Device         string    `json:"device"`
+	State          string    `json:"state"`
+	RecordsSent    int64     `json:"records_sent"`
+	BytesSent      int64     `json:"bytes_sent"`
+	Errors         int64     `json:"errors"`
+	Dropped        int64     `json:"dropped"`
+	LastRecordTime time.Time `json:"last_record_time"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+func newTeeOutput(parent *config.PortConfig, teeCfg config.TeeConfig, recovery *config.RecoveryConfig, logger *slog.Logger) *teeOutput {
+	return &teeOutput{
+		config:   parent.TeePortConfig(teeCfg),
+		recovery: recovery,
+		logger:   logger.With("tee", teeCfg.Device),
+		queue:    make(chan teeItem, teeCfg.BufferSize),
+		stats: TeeStats{
+			Device: teeCfg.Device,
+			State:  string(StateInitializing),
+		},
+	}
+}
+
+// start launches the delivery goroutine. The device is opened there so a
+// tee that is unavailable at startup does not hold up the channel.
+func (t *teeOutput) start() {
+	t.wg.Add(1)
+	go t.run()
+}
+
+// stop delivers any queued records, then closes the device
+func (t *teeOutput) stop() {
+	close(t.queue)
+	t.wg.Wait()
+
+	if t.port != nil {
+		t.port.Close()
+		t.takeDeliveries()
+	}
+	t.setState(StateStopped)
+}
+
+// enqueue hands a record to the tee without blocking. When the queue is full
+// the record is dropped and counted.
+func (t *teeOutput) enqueue(meta serial.RecordMeta, data []byte) {
+	select {
+	case t.queue <- teeItem{meta: meta, data: data}:
+	default:
+		t.drop()
+	}
+}
+
+func (t *teeOutput) run() {
+	defer t.wg.Done()
+
+	var nextAttempt time.Time
+	delay := t.recovery.GetReconnectDelay()
+
+	for {
+		var item teeItem
+		select {
+		case queued, ok := <-t.queue:
+			if !ok {
+				return
+			}
+			item = queued
+		case <-t.deliveriesReady():
+			t.takeDeliveries()
+			continue
+		}
+
+		if t.port == nil || !t.port.IsOpen() {
+			// Records arriving while the device is down are dropped rather
+			// than waiting out the reconnect delay
+			if time.Now().Before(nextAttempt) {
+				t.drop()
+				continue
+			}
+
+			if err := t.open(); err != nil {
+				t.recordError(fmt.Errorf("failed to open tee: %w", err))
+				t.setState(StateReconnecting)
+				t.drop()
+
+				nextAttempt = time.Now().Add(delay)
+				if t.recovery.ExponentialBackoff {
+					delay *= 2
+					if maxDelay := t.recovery.GetMaxReconnectDelay(); delay > maxDelay {
+						delay = maxDelay
+					}
+				}
+				continue
+			}
+
+			delay = t.recovery.GetReconnectDelay()
+			t.setState(StateRunning)
+		}
+
+		t.write(item)
+	}
+}
+
+func (t *teeOutput) open() error {
+	if t.port != nil {
+		t.port.Close()
+		t.takeDeliveries()
+	}
+
+	port, err := openDevice(&t.config, t.logger)
+	if err != nil {
+		t.port = nil
+		return err
+	}
+
+	t.port = port
+	t.logger.Info("Tee device opened")
+	return nil
+}
+
+func (t *teeOutput) write(item teeItem) {
+	var n int
+	var err error
+	if rw, ok := t.port.(serial.RecordWriter); ok {
+		n, err = rw.WriteRecord(item.meta, item.data)
+	} else {
+		n, err = t.port.Write(item.data)
+	}
+	if errors.Is(err, serial.ErrQueued) {
+		// Counted when the port reports the delivery
+		return
+	}
+	if err != nil {
+		t.recordError(fmt.Errorf("failed to write to tee: %w", err))
+		return
+	}
+
+	if err := t.port.Flush(); err != nil {
+		t.logger.Warn("Failed to flush tee", "error", err)
+	}
+
+	t.recordSent(n)
+}
+
+func (t *teeOutput) recordSent(n int) {
+	t.statsMutex.Lock()
+	t.stats.RecordsSent++
+	t.stats.BytesSent += int64(n)
+	t.stats.LastRecordTime = time.Now()
+	t.statsMutex.Unlock()
+}
+
+// deliveriesReady returns a channel that fires when the device has reported
+// deliveries of queued records, or nil if it never queues them
+func (t *teeOutput) deliveriesReady() <-chan struct{} {
+	if dw, ok := t.port.(serial.DeferredWriter); ok {
+		return dw.Ready()
+	}
+	return nil
+}
+
+// takeDeliveries counts the queued records the device has sent, or failed to
+func (t *teeOutput) takeDeliveries() {
+	dw, ok := t.port.(serial.DeferredWriter)
+	if !ok {
+		return
+	}
+	for _, d := range dw.Deliveries() {
+		if d.Err != nil {
+			t.recordError(fmt.Errorf("failed to deliver record %s to tee: %w", d.Meta.ID, d.Err))
+			continue
+		}
+		t.recordSent(d.Bytes)
+	}
+}
+
+func (t *teeOutput) drop() {
+	t.statsMutex.Lock()
+	t.stats.Dropped++
+	t.statsMutex.Unlock()
+}
+
+func (t *teeOutput) recordError(err error) {
+	t.statsMutex.Lock()
+	t.stats.Errors++
+	t.stats.LastError = err.Error()
+	t.statsMutex.Unlock()
+
+	t.logger.Error("Tee error", "error", err)
+}
+
+func (t *teeOutput) setState(state ChannelState) {
+	t.statsMutex.Lock()
+	t.stats.State = string(state)
+	t.statsMutex.Unlock()
+}
+
+// Stats returns a copy of the tee statistics
+func (t *teeOutput) Stats() TeeStats {
+	t.statsMutex.RLock()
+	defer t.statsMutex.RUnlock()
+	return t.stats
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package serial
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// setFlowControl applies the flow control mode to the device's termios.
+// Settings belong to the tty rather than the file descriptor, so a second
+// descriptor is used alongside the one held by the serial library.
+func setFlowControl(device, mode string) error {
+	if mode == "" || mode == FlowNone {
+		return nil
+	}
+
+	fd, err := unix.Open(device, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case FlowRTSCTS:
+		t.Cflag |= unix.CRTSCTS
+		t.Iflag &^= unix.IXON | unix.IXOFF | unix.IXANY
+	case FlowXONXOFF:
+		t.Cflag &^= unix.CRTSCTS
+		t.Iflag |= unix.IXON | unix.IXOFF
+		t.Iflag &^= unix.IXANY
+		t.Cc[unix.VSTART] = 0x11 // DC1
+		t.Cc[unix.VSTOP] = 0x13  // DC3
+	default:
+		return fmt.Errorf("unknown flow control mode: %s", mode)
+	}
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
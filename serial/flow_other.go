@@ -0,0 +1,13 @@
+//go:build !linux
+
+package serial
+
+import "fmt"
+
+// setFlowControl is only supported on Linux
+func setFlowControl(device, mode string) error {
+	if mode == "" || mode == FlowNone {
+		return nil
+	}
+	return fmt.Errorf("flow control is only supported on Linux")
+}
@@ -0,0 +1,309 @@
+package serial
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP payload encodings
+const (
+	PayloadRaw  = "raw"
+	PayloadJSON = "json"
+)
+
+// HTTPPortConfig contains settings for an HTTP webhook port
+type HTTPPortConfig struct {
+	URL           string
+	Payload       string // "raw" or "json"
+	Timeout       time.Duration
+	MaxRetries    int
+	RetryDelay    time.Duration
+	Headers       map[string]string
+	BatchSize     int           // Records per POST; 0 or 1 disables batching
+	BatchInterval time.Duration // Maximum time a partial batch is held
+}
+
+// HTTPPort implements Port by POSTing each record to an HTTP endpoint.
+// With batching, WriteRecord queues records and returns ErrQueued; the
+// outcome of each is reported through Deliveries once its batch is posted.
+type HTTPPort struct {
+	config HTTPPortConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	pending   []httpBatchItem
+	delivered []Delivery    // Outcomes of posted batches, not yet taken
+	ready     chan struct{} // Signalled when delivered is not empty
+	isOpen    bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type httpBatchItem struct {
+	meta RecordMeta
+	data []byte
+}
+
+// NewHTTPPort creates a new webhook port
+func NewHTTPPort(config HTTPPortConfig) *HTTPPort {
+	p := &HTTPPort{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+		},
+		ready:  make(chan struct{}, 1),
+		isOpen: true,
+		done:   make(chan struct{}),
+	}
+
+	if p.batching() && config.BatchInterval > 0 {
+		p.wg.Add(1)
+		go p.batchLoop()
+	}
+
+	return p
+}
+
+// Write posts raw data that has no record metadata attached
+func (p *HTTPPort) Write(data []byte) (int, error) {
+	meta := RecordMeta{
+		Timestamp: time.Now(),
+		Lines:     strings.Split(strings.TrimRight(string(data), "\n"), "\n"),
+	}
+	return p.WriteRecord(meta, data)
+}
+
+// WriteRecord posts a record, or queues it and returns ErrQueued when
+// batching is enabled
+func (p *HTTPPort) WriteRecord(meta RecordMeta, data []byte) (int, error) {
+	p.mu.Lock()
+
+	if !p.isOpen {
+		p.mu.Unlock()
+		return 0, fmt.Errorf("port is closed")
+	}
+
+	item := httpBatchItem{meta: meta, data: append([]byte(nil), data...)}
+
+	if !p.batching() {
+		p.mu.Unlock()
+		if err := p.post([]httpBatchItem{item}); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	p.pending = append(p.pending, item)
+	if len(p.pending) < p.config.BatchSize {
+		p.mu.Unlock()
+		return 0, ErrQueued
+	}
+
+	batch := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	p.postBatch(batch)
+	return 0, ErrQueued
+}
+
+// Close sends any partial batch and stops the port
+func (p *HTTPPort) Close() error {
+	p.mu.Lock()
+	if !p.isOpen {
+		p.mu.Unlock()
+		return nil
+	}
+	p.isOpen = false
+	batch := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+
+	if len(batch) > 0 {
+		return p.postBatch(batch)
+	}
+	return nil
+}
+
+// Ready is signalled when posted batches have deliveries to take
+func (p *HTTPPort) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Deliveries returns the outcome of every queued record posted since the
+// last call
+func (p *HTTPPort) Deliveries() []Delivery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delivered := p.delivered
+	p.delivered = nil
+	return delivered
+}
+
+// postBatch posts a batch and records the outcome of each of its records
+func (p *HTTPPort) postBatch(batch []httpBatchItem) error {
+	err := p.post(batch)
+
+	p.mu.Lock()
+	for _, item := range batch {
+		d := Delivery{Meta: item.meta, Err: err}
+		if err == nil {
+			d.Bytes = len(item.data)
+		}
+		p.delivered = append(p.delivered, d)
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Flush is a no-op; unbatched records are posted synchronously and batches
+// are sent by size or interval
+func (p *HTTPPort) Flush() error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return nil
+}
+
+// Device returns the endpoint URL
+func (p *HTTPPort) Device() string {
+	return p.config.URL
+}
+
+// IsOpen returns true until the port is closed
+func (p *HTTPPort) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isOpen
+}
+
+func (p *HTTPPort) batching() bool {
+	return p.config.BatchSize > 1
+}
+
+// batchLoop sends partial batches that have waited longer than BatchInterval
+func (p *HTTPPort) batchLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			batch := p.pending
+			p.pending = nil
+			p.mu.Unlock()
+
+			if len(batch) > 0 {
+				p.postBatch(batch)
+			}
+		}
+	}
+}
+
+// post sends a batch, retrying transport errors, 429 and 5xx responses
+func (p *HTTPPort) post(batch []httpBatchItem) error {
+	body, contentType, err := p.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	delay := p.config.RetryDelay
+	var lastErr error
+
+	for attempt := 0; attempt <= p.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		retry, err := p.send(body, contentType, len(batch))
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+
+	return fmt.Errorf("POST %s failed: %w", p.config.URL, lastErr)
+}
+
+// send performs a single POST and reports whether a failure is worth retrying
+func (p *HTTPPort) send(body []byte, contentType string, count int) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-CDR-Record-Count", fmt.Sprintf("%d", count))
+	for name, value := range p.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("server returned status %d", resp.StatusCode)
+}
+
+// encode builds the request body. Raw batches are the records concatenated
+// exactly as they would appear on the wire; JSON batches are an array of
+// envelopes.
+func (p *HTTPPort) encode(batch []httpBatchItem) ([]byte, string, error) {
+	if p.config.Payload == PayloadRaw {
+		var buf bytes.Buffer
+		for _, item := range batch {
+			buf.Write(item.data)
+		}
+		return buf.Bytes(), "text/plain; charset=utf-8", nil
+	}
+
+	var v interface{}
+	if p.batching() {
+		envelopes := make([]RecordMeta, len(batch))
+		for i, item := range batch {
+			envelopes[i] = item.meta
+		}
+		v = envelopes
+	} else {
+		v = batch[0].meta
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal record: %w", err)
+	}
+	return body, "application/json", nil
+}
@@ -0,0 +1,122 @@
+package serial
+
+import (
+	"fmt"
+	"time"
+)
+
+// pacedChunkTime is roughly how much line time each paced write covers.
+// Writing a few characters at a time keeps timing accurate without a
+// syscall per byte at higher baud rates.
+const pacedChunkTime = 10 * time.Millisecond
+
+// PacingConfig describes the line a paced port reproduces
+type PacingConfig struct {
+	BaudRate int // 0 disables baud pacing
+	DataBits int
+	StopBits int
+	Parity   string
+
+	InterCharDelay time.Duration // Extra gap after every character
+}
+
+// CharTime returns how long one character takes on the line, including
+// the start bit, parity bit and stop bits
+func (c PacingConfig) CharTime() time.Duration {
+	if c.BaudRate <= 0 {
+		return 0
+	}
+
+	bits := 1 + c.DataBits + c.StopBits
+	if c.Parity != "" && c.Parity != "none" {
+		bits++
+	}
+	return time.Duration(bits) * time.Second / time.Duration(c.BaudRate)
+}
+
+// PacedPort wraps a Port and releases bytes no faster than a real serial
+// line would, so instant transports (stdout, TCP, PTY) behave like one
+type PacedPort struct {
+	Port
+	charTime  time.Duration
+	chunkSize int
+	stop      <-chan struct{}
+}
+
+// NewPacedPort wraps port with pacing. A write in progress is abandoned
+// when stop is closed.
+func NewPacedPort(port Port, cfg PacingConfig, stop <-chan struct{}) *PacedPort {
+	charTime := cfg.CharTime() + cfg.InterCharDelay
+
+	chunkSize := 1
+	if cfg.InterCharDelay == 0 && charTime > 0 && charTime < pacedChunkTime {
+		chunkSize = int(pacedChunkTime / charTime)
+	}
+
+	return &PacedPort{
+		Port:      port,
+		charTime:  charTime,
+		chunkSize: chunkSize,
+		stop:      stop,
+	}
+}
+
+// Write writes data in small chunks, holding each until the line would
+// have finished sending the previous one
+func (p *PacedPort) Write(data []byte) (int, error) {
+	if p.charTime == 0 {
+		return p.Port.Write(data)
+	}
+
+	start := time.Now()
+	written := 0
+
+	for written < len(data) {
+		end := written + p.chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		n, err := p.Port.Write(data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		due := start.Add(time.Duration(written) * p.charTime)
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-p.stop:
+				timer.Stop()
+				return written, fmt.Errorf("paced write interrupted after %d of %d bytes", written, len(data))
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// CharTime returns the line time of one character, including any
+// inter-character delay
+func (p *PacedPort) CharTime() time.Duration {
+	return p.charTime
+}
+
+// Unwrap returns the underlying port
+func (p *PacedPort) Unwrap() Port {
+	return p.Port
+}
+
+// Unwrap returns the innermost port behind any wrappers, for checking
+// optional interfaces such as io.Reader or FlowReporter
+func Unwrap(port Port) Port {
+	for {
+		w, ok := port.(interface{ Unwrap() Port })
+		if !ok {
+			return port
+		}
+		port = w.Unwrap()
+	}
+}
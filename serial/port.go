@@ -1,6 +1,7 @@
 package serial
 
 import (
+	"errors"
 	"io"
 	"time"
 )
@@ -12,8 +13,18 @@ type PortConfig struct {
 	DataBits int
 	StopBits int
 	Parity   string // "none", "odd", "even"
+
+	FlowControl string        // "none", "rtscts", "xonxoff"
+	CTSTimeout  time.Duration // Maximum wait for CTS before a write fails (rtscts only)
 }
 
+// Flow control modes
+const (
+	FlowNone    = "none"
+	FlowRTSCTS  = "rtscts"
+	FlowXONXOFF = "xonxoff"
+)
+
 // Port defines the interface for serial port operations
 type Port interface {
 	io.WriteCloser
@@ -28,6 +39,59 @@ type Port interface {
 	IsOpen() bool
 }
 
+// RecordMeta describes the CDR record behind a write
+type RecordMeta struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Format    string    `json:"format"`
+	Lines     []string  `json:"lines"`
+}
+
+// RecordWriter is implemented by ports that deliver whole records rather
+// than a byte stream, and can make use of the record metadata
+type RecordWriter interface {
+	WriteRecord(meta RecordMeta, data []byte) (int, error)
+}
+
+// ErrQueued is returned by WriteRecord when the port has queued the record
+// to send later. Its outcome is reported through DeferredWriter.
+var ErrQueued = errors.New("record queued")
+
+// Delivery is the outcome of sending a queued record
+type Delivery struct {
+	Meta  RecordMeta
+	Bytes int   // Bytes sent; 0 on failure
+	Err   error // Set if the record could not be sent
+}
+
+// DeferredWriter is implemented by ports that queue records and send them
+// later, such as a batching webhook. Ready is signalled when deliveries are
+// waiting; Deliveries takes them.
+type DeferredWriter interface {
+	Ready() <-chan struct{}
+	Deliveries() []Delivery
+}
+
+// FlowStats tracks time spent waiting on hardware flow control
+type FlowStats struct {
+	Stalls    int64         // Writes that had to wait for CTS
+	StallTime time.Duration // Total time spent waiting for CTS
+	Timeouts  int64         // Writes abandoned because CTS never asserted
+}
+
+// FlowReporter is implemented by ports that honor hardware flow control
+type FlowReporter interface {
+	FlowStats() FlowStats
+}
+
+// LineController is implemented by ports with modem control lines
+type LineController interface {
+	SetDTR(on bool) error
+	SetRTS(on bool) error
+	Break(d time.Duration) error
+}
+
 // Stats tracks statistics for a serial port
 type Stats struct {
 	BytesSent      int64
@@ -64,6 +128,25 @@ func (p *PortWithStats) Write(data []byte) (int, error) {
 	return n, nil
 }
 
+// WriteRecord writes a record, passing its metadata to ports that use it
+func (p *PortWithStats) WriteRecord(meta RecordMeta, data []byte) (int, error) {
+	rw, ok := p.Port.(RecordWriter)
+	if !ok {
+		return p.Write(data)
+	}
+
+	n, err := rw.WriteRecord(meta, data)
+	if errors.Is(err, ErrQueued) {
+		return n, err
+	}
+	if err != nil {
+		p.stats.Errors++
+		return n, err
+	}
+	p.stats.BytesSent += int64(n)
+	return n, nil
+}
+
 // RecordSent increments the records sent counter
 func (p *PortWithStats) RecordSent() {
 	p.stats.RecordsSent++
@@ -0,0 +1,250 @@
+//go:build linux
+
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ptyWriteTimeout bounds how long a write may block when nobody is
+// reading the slave side of the pair
+const ptyWriteTimeout = 5 * time.Second
+
+// PTYPort implements Port using the master side of a pseudo-terminal pair.
+// A collector process on the same host opens the slave side (or the stable
+// symlink pointing at it) exactly like a real /dev/ttyS* device.
+type PTYPort struct {
+	mu        sync.Mutex
+	master    *os.File
+	slave     *os.File
+	device    string
+	slavePath string
+	linkPath  string
+	isOpen    bool
+}
+
+// OpenPTY creates a new pseudo-terminal pair and links linkPath to its slave.
+// The slave is held open and put into raw mode so that the pair survives
+// collectors connecting and disconnecting, and bytes pass through unmodified.
+func OpenPTY(name, linkPath string) (*PTYPort, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	slavePath, err := unlockPTY(master)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(slavePath, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open pty slave %s: %w", slavePath, err)
+	}
+
+	if err := makeRaw(slave); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("failed to set raw mode on %s: %w", slavePath, err)
+	}
+
+	if linkPath != "" {
+		if err := replaceSymlink(slavePath, linkPath); err != nil {
+			slave.Close()
+			master.Close()
+			return nil, err
+		}
+	}
+
+	return &PTYPort{
+		master:    master,
+		slave:     slave,
+		device:    "pty://" + name,
+		slavePath: slavePath,
+		linkPath:  linkPath,
+		isOpen:    true,
+	}, nil
+}
+
+// Write writes data to the master side of the pair
+func (p *PTYPort) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isOpen {
+		return 0, fmt.Errorf("port is closed")
+	}
+
+	// Deadlines are best effort; not every kernel lets ptmx join the poller
+	_ = p.master.SetWriteDeadline(time.Now().Add(ptyWriteTimeout))
+
+	n, err := p.master.Write(data)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// Nobody is draining the slave. Discard what is queued so a collector
+		// that attaches later starts on fresh data rather than a stale backlog.
+		p.flushSlaveInput()
+		return n, fmt.Errorf("pty %s: no reader on %s", p.device, p.slavePath)
+	}
+	return n, err
+}
+
+// Read reads data written by the collector to the slave side
+func (p *PTYPort) Read(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, fmt.Errorf("port is closed")
+	}
+	return p.master.Read(buf)
+}
+
+// Close closes both sides of the pair and removes the symlink
+func (p *PTYPort) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isOpen {
+		return nil
+	}
+	p.isOpen = false
+
+	// Only remove the link if it still points at our slave
+	if p.linkPath != "" {
+		if target, err := os.Readlink(p.linkPath); err == nil && target == p.slavePath {
+			os.Remove(p.linkPath)
+		}
+	}
+
+	p.slave.Close()
+	return p.master.Close()
+}
+
+// Flush is a no-op for pty ports; data is handed to the slave on write
+func (p *PTYPort) Flush() error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return nil
+}
+
+// Device returns the pty:// device name
+func (p *PTYPort) Device() string {
+	return p.device
+}
+
+// IsOpen returns true if the pair is open
+func (p *PTYPort) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isOpen
+}
+
+// SlavePath returns the /dev/pts path a collector should open
+func (p *PTYPort) SlavePath() string {
+	return p.slavePath
+}
+
+// LinkPath returns the stable symlink pointing at the slave
+func (p *PTYPort) LinkPath() string {
+	return p.linkPath
+}
+
+func (p *PTYPort) flushSlaveInput() {
+	rc, err := p.slave.SyscallConn()
+	if err != nil {
+		return
+	}
+	rc.Control(func(fd uintptr) {
+		unix.IoctlSetInt(int(fd), unix.TCFLSH, unix.TCIFLUSH)
+	})
+}
+
+// unlockPTY unlocks the slave and returns its path. SyscallConn is used
+// instead of Fd() so the master keeps its non-blocking mode.
+func unlockPTY(master *os.File) (string, error) {
+	rc, err := master.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+
+	var ptyNum int
+	var ctlErr error
+	err = rc.Control(func(fd uintptr) {
+		if ctlErr = unix.IoctlSetPointerInt(int(fd), unix.TIOCSPTLCK, 0); ctlErr != nil {
+			ctlErr = fmt.Errorf("failed to unlock pty: %w", ctlErr)
+			return
+		}
+		if ptyNum, ctlErr = unix.IoctlGetInt(int(fd), unix.TIOCGPTN); ctlErr != nil {
+			ctlErr = fmt.Errorf("failed to get pty number: %w", ctlErr)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if ctlErr != nil {
+		return "", ctlErr
+	}
+
+	return fmt.Sprintf("/dev/pts/%d", ptyNum), nil
+}
+
+// makeRaw applies the equivalent of cfmakeraw(3) to a terminal
+func makeRaw(f *os.File) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ctlErr error
+	err = rc.Control(func(fd uintptr) {
+		t, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if err != nil {
+			ctlErr = err
+			return
+		}
+
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP |
+			unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB
+		t.Cflag |= unix.CS8
+		t.Cc[unix.VMIN] = 1
+		t.Cc[unix.VTIME] = 0
+
+		ctlErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, t)
+	})
+	if err != nil {
+		return err
+	}
+	return ctlErr
+}
+
+// replaceSymlink points linkPath at target, replacing a stale link left by a
+// previous run. Anything at linkPath that is not a symlink is left alone.
+func replaceSymlink(target, linkPath string) error {
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return fmt.Errorf("failed to create pty link directory: %w", err)
+	}
+
+	if info, err := os.Lstat(linkPath); err == nil {
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("pty link %s exists and is not a symlink", linkPath)
+		}
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("failed to remove stale pty link: %w", err)
+		}
+	}
+
+	if err := os.Symlink(target, linkPath); err != nil {
+		return fmt.Errorf("failed to create pty link: %w", err)
+	}
+	return nil
+}
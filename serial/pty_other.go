@@ -0,0 +1,25 @@
+//go:build !linux
+
+package serial
+
+import "fmt"
+
+// PTYPort is only available on Linux
+type PTYPort struct {
+	Port
+}
+
+// OpenPTY is only supported on Linux
+func OpenPTY(name, linkPath string) (*PTYPort, error) {
+	return nil, fmt.Errorf("pty devices are only supported on Linux")
+}
+
+// SlavePath returns an empty string on unsupported platforms
+func (p *PTYPort) SlavePath() string {
+	return ""
+}
+
+// LinkPath returns an empty string on unsupported platforms
+func (p *PTYPort) LinkPath() string {
+	return ""
+}
@@ -0,0 +1,95 @@
+package serial
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tcpWriteTimeout bounds how long a write may block on a stalled peer
+const tcpWriteTimeout = 10 * time.Second
+
+// TCPPort implements Port over a TCP connection to a listening collector
+type TCPPort struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	device string
+	isOpen bool
+}
+
+// DialTCP connects to the address in a tcp://host:port device
+func DialTCP(device string, timeout time.Duration) (*TCPPort, error) {
+	addr := strings.TrimPrefix(device, "tcp://")
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	return &TCPPort{
+		conn:   conn,
+		device: device,
+		isOpen: true,
+	}, nil
+}
+
+// Write writes data to the connection. Any failure closes the port so the
+// channel reconnects.
+func (p *TCPPort) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isOpen {
+		return 0, fmt.Errorf("port is closed")
+	}
+
+	p.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	n, err := p.conn.Write(data)
+	if err != nil {
+		p.isOpen = false
+		p.conn.Close()
+	}
+	return n, err
+}
+
+// Read reads data sent back by the peer
+func (p *TCPPort) Read(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, fmt.Errorf("port is closed")
+	}
+	return p.conn.Read(buf)
+}
+
+// Close closes the connection
+func (p *TCPPort) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isOpen {
+		return nil
+	}
+	p.isOpen = false
+	return p.conn.Close()
+}
+
+// Flush is a no-op for TCP ports
+func (p *TCPPort) Flush() error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return nil
+}
+
+// Device returns the tcp:// device string
+func (p *TCPPort) Device() string {
+	return p.device
+}
+
+// IsOpen returns true if the connection is open
+func (p *TCPPort) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isOpen
+}
@@ -1,17 +1,31 @@
 package serial
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.bug.st/serial"
 )
 
+// ctsPollInterval is how often CTS is sampled while a write is held off
+const ctsPollInterval = 10 * time.Millisecond
+
+// ErrCTSTimeout is returned when the remote end never asserts CTS
+var ErrCTSTimeout = errors.New("timed out waiting for CTS")
+
 // RealPort implements Port using a real serial port
 type RealPort struct {
 	port   serial.Port
 	config PortConfig
+
+	// The receive loop checks isOpen while the output loop may close
+	mu     sync.Mutex
 	isOpen bool
+
+	flowStats FlowStats
+	flowMutex sync.Mutex
 }
 
 // Open opens a serial port with the given configuration
@@ -34,6 +48,12 @@ func Open(config PortConfig) (*RealPort, error) {
 		return nil, fmt.Errorf("failed to set read timeout: %w", err)
 	}
 
+	// The serial library always opens with flow control disabled
+	if err := setFlowControl(config.Device, config.FlowControl); err != nil {
+		port.Close()
+		return nil, fmt.Errorf("failed to set flow control: %w", err)
+	}
+
 	return &RealPort{
 		port:   port,
 		config: config,
@@ -41,26 +61,118 @@ func Open(config PortConfig) (*RealPort, error) {
 	}, nil
 }
 
-// Write writes data to the serial port
+// Write writes data to the serial port. With RTS/CTS flow control the
+// write is held until the remote end asserts CTS.
 func (p *RealPort) Write(data []byte) (int, error) {
-	if !p.isOpen {
+	if !p.IsOpen() {
 		return 0, fmt.Errorf("port is closed")
 	}
+
+	if p.config.FlowControl == FlowRTSCTS {
+		if err := p.waitForCTS(); err != nil {
+			return 0, err
+		}
+	}
+
 	return p.port.Write(data)
 }
 
+// Read reads data sent by the remote end. It returns 0 bytes and no error
+// when the read timeout expires without data. It may run alongside Close,
+// which wakes a read in progress; the read then fails with the port closed.
+func (p *RealPort) Read(buf []byte) (int, error) {
+	if !p.IsOpen() {
+		return 0, fmt.Errorf("port is closed")
+	}
+	return p.port.Read(buf)
+}
+
+// FlowStats returns flow control statistics since the port was opened
+func (p *RealPort) FlowStats() FlowStats {
+	p.flowMutex.Lock()
+	defer p.flowMutex.Unlock()
+	return p.flowStats
+}
+
+// waitForCTS polls the modem status until CTS is asserted or the configured
+// timeout expires, recording any stall
+func (p *RealPort) waitForCTS() error {
+	status, err := p.port.GetModemStatusBits()
+	if err != nil {
+		return fmt.Errorf("failed to read modem status: %w", err)
+	}
+	if status.CTS {
+		return nil
+	}
+
+	start := time.Now()
+	deadline := start.Add(p.config.CTSTimeout)
+
+	for {
+		time.Sleep(ctsPollInterval)
+
+		status, err = p.port.GetModemStatusBits()
+		if err != nil {
+			return fmt.Errorf("failed to read modem status: %w", err)
+		}
+
+		if status.CTS || time.Now().After(deadline) {
+			p.flowMutex.Lock()
+			p.flowStats.Stalls++
+			p.flowStats.StallTime += time.Since(start)
+			if !status.CTS {
+				p.flowStats.Timeouts++
+			}
+			p.flowMutex.Unlock()
+
+			if !status.CTS {
+				return ErrCTSTimeout
+			}
+			return nil
+		}
+	}
+}
+
+// SetDTR raises or lowers the DTR line
+func (p *RealPort) SetDTR(on bool) error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return p.port.SetDTR(on)
+}
+
+// SetRTS raises or lowers the RTS line
+func (p *RealPort) SetRTS(on bool) error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return p.port.SetRTS(on)
+}
+
+// Break holds the line in the break condition for d
+func (p *RealPort) Break(d time.Duration) error {
+	if !p.IsOpen() {
+		return fmt.Errorf("port is closed")
+	}
+	return p.port.Break(d)
+}
+
 // Close closes the serial port
 func (p *RealPort) Close() error {
+	p.mu.Lock()
 	if !p.isOpen {
+		p.mu.Unlock()
 		return nil
 	}
 	p.isOpen = false
+	p.mu.Unlock()
+
 	return p.port.Close()
 }
 
 // Flush waits until all output has been transmitted
 func (p *RealPort) Flush() error {
-	if !p.isOpen {
+	if !p.IsOpen() {
 		return fmt.Errorf("port is closed")
 	}
 	return p.port.Drain()
@@ -73,6 +185,8 @@ func (p *RealPort) Device() string {
 
 // IsOpen returns true if the port is currently open
 func (p *RealPort) IsOpen() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.isOpen
 }
 
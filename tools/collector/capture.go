@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/csv"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cdrgenerator/format"
+)
+
+// sampleWriter writes captured lines in the sysident,message layout of the
+// replay sample files. The sysident is the time the line arrived, in
+// milliseconds since the Unix epoch, so the file keeps the order and
+// timing of the capture.
+type sampleWriter struct {
+	file *os.File
+	csv  *csv.Writer
+	last int64
+}
+
+func createSample(path string) (*sampleWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &sampleWriter{file: file, csv: csv.NewWriter(file)}
+	w.csv.Write([]string{"sysident", "message"})
+	w.csv.Flush()
+	return w, w.csv.Error()
+}
+
+// write adds lines and flushes them, so an interrupted capture keeps every
+// complete record
+func (w *sampleWriter) write(lines []feedLine) error {
+	for _, line := range lines {
+		// Lines arriving in the same millisecond keep their order
+		sysident := line.at.UnixMilli()
+		if sysident <= w.last {
+			sysident = w.last + 1
+		}
+		w.last = sysident
+
+		w.csv.Write([]string{strconv.FormatInt(sysident, 10), line.text})
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *sampleWriter) Close() error {
+	return w.file.Close()
+}
+
+// capture writes the records read from the feed to a sample file until
+// stopped. Only complete records are written: a record still open at the
+// end is dropped, and so is the first one unless it starts with a
+// separator line or keepFirst is set, as the capture may have started
+// part way through it.
+func capture(f format.CDRFormat, lines <-chan feedLine, path string, keepFirst bool,
+	stop <-chan os.Signal, deadline <-chan time.Time) bool {
+
+	out, err := createSample(path)
+	if err != nil {
+		log.Printf("Failed to create sample file: %v", err)
+		return false
+	}
+	defer out.Close()
+	log.Printf("Capturing %s records to %s", f.Name(), path)
+
+	splitter := format.NewSplitter(f)
+	first := true
+	var pending []feedLine
+	records := 0
+
+	for {
+		select {
+		case line := <-lines:
+			pending = append(pending, line)
+			completed, err := splitter.Add(line.text)
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				continue
+			}
+			if len(completed) == 0 {
+				continue
+			}
+
+			// The splitter has used every line it was given
+			group := pending
+			pending = nil
+
+			if first {
+				first = false
+				if !keepFirst && !format.IsSeparator(f, completed[0].Lines[0]) {
+					log.Printf("Skipped first record, which may have been cut off (use -keep-first to keep it)")
+					completed = completed[1:]
+					group = linesAfter(group, f, completed)
+				}
+			}
+			if len(completed) == 0 {
+				continue
+			}
+
+			if err := out.write(group); err != nil {
+				log.Printf("Failed to write sample file: %v", err)
+				return false
+			}
+			records += len(completed)
+			for _, record := range completed {
+				log.Printf("Captured %s record %s (%d lines)", record.Type, displayID(record.ID), len(record.Lines))
+			}
+		case <-stop:
+			return finishCapture(pending, records, path)
+		case <-deadline:
+			return finishCapture(pending, records, path)
+		}
+	}
+}
+
+// linesAfter drops the lines of the first record from group, leaving the
+// lines of the records that follow it
+func linesAfter(group []feedLine, f format.CDRFormat, rest []format.CDRRecord) []feedLine {
+	if len(rest) == 0 {
+		return nil
+	}
+	// The first record ends at its separator line
+	for i, line := range group {
+		if format.IsSeparator(f, line.text) {
+			return group[i+1:]
+		}
+	}
+	return group
+}
+
+func finishCapture(pending []feedLine, records int, path string) bool {
+	if len(pending) > 0 {
+		log.Printf("Dropped %d lines of an incomplete record", len(pending))
+	}
+	log.Printf("Captured %d records to %s", records, path)
+	return records > 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"cdrgenerator/serial"
+)
+
+// feedLine is one line received from the feed, and when its last byte
+// arrived
+type feedLine struct {
+	text string
+	at   time.Time
+}
+
+// feedConfig describes where the collector reads from: a serial device
+// (including the slave side of a pty:// pair), a TCP listen address for
+// tcp:// outputs, which connect to the collector, or the address of a
+// system that serves its feed over TCP
+type feedConfig struct {
+	device      string
+	listen      string
+	connect     string
+	baud        int
+	stripParity bool
+}
+
+// feedRetryDelay is the pause before reconnecting to a -connect feed
+const feedRetryDelay = 5 * time.Second
+
+// readFeed reads lines from the feed until it fails, sending them to
+// lines. A TCP feed accepts connections one after another, so a sender
+// that reconnects is picked up again; a -connect feed reconnects itself.
+func readFeed(cfg feedConfig, lines chan<- feedLine) error {
+	if cfg.connect != "" {
+		go func() {
+			for {
+				conn, err := net.Dial("tcp", cfg.connect)
+				if err != nil {
+					log.Printf("Connect error: %v", err)
+					time.Sleep(feedRetryDelay)
+					continue
+				}
+				log.Printf("Connected to %s", cfg.connect)
+				readLines(conn, cfg.stripParity, lines)
+				conn.Close()
+				log.Printf("Connection to %s closed", cfg.connect)
+				time.Sleep(feedRetryDelay)
+			}
+		}()
+		return nil
+	}
+
+	if cfg.listen != "" {
+		ln, err := net.Listen("tcp", cfg.listen)
+		if err != nil {
+			return err
+		}
+		log.Printf("Listening on %s", ln.Addr())
+
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					log.Printf("Accept error: %v", err)
+					return
+				}
+				log.Printf("Connection from %s", conn.RemoteAddr())
+				readLines(conn, cfg.stripParity, lines)
+				conn.Close()
+				log.Printf("Connection from %s closed", conn.RemoteAddr())
+			}
+		}()
+		return nil
+	}
+
+	port, err := serial.Open(serial.PortConfig{
+		Device:   cfg.device,
+		BaudRate: cfg.baud,
+		DataBits: 8,
+		StopBits: 1,
+		Parity:   "none",
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading %s at %d baud", cfg.device, cfg.baud)
+
+	go func() {
+		defer port.Close()
+		readLines(port, cfg.stripParity, lines)
+		log.Printf("Read from %s ended", cfg.device)
+	}()
+	return nil
+}
+
+// readLines splits r into lines on CR or LF and sends each non-empty line
+func readLines(r io.Reader, stripParity bool, lines chan<- feedLine) {
+	buf := make([]byte, 4096)
+	var line []byte
+
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if stripParity {
+				b &= 0x7F
+			}
+			if b != '\n' && b != '\r' {
+				line = append(line, b)
+				continue
+			}
+			if text := cleanLine(line); text != "" {
+				lines <- feedLine{text: text, at: time.Now()}
+			}
+			line = line[:0]
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Read error: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// cleanLine removes framing bytes such as STX/ETX and the padding some
+// systems add to fixed-width lines
+func cleanLine(line []byte) string {
+	text := strings.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\t') || r == 0x7F {
+			return -1
+		}
+		return r
+	}, string(line))
+	return strings.TrimRight(text, " ")
+}
@@ -0,0 +1,164 @@
+// Command collector stands in for the system at the far end of a
+// PollenPusher output. It reads a serial, pty or TCP feed and groups the
+// lines back into records using the format's parser.
+//
+// In verify mode it follows a PollenPusher instance's event stream and
+// reports records that went missing, arrived twice, arrived damaged or
+// arrived out of order, and the end-to-end latency.
+//
+// In capture mode it records a live feed, such as one from a real 911
+// system, into a sample file for replay mode.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cdrgenerator/format"
+	_ "cdrgenerator/format/vesta"
+	_ "cdrgenerator/format/viper"
+	"cdrgenerator/output"
+)
+
+func main() {
+	mode := flag.String("mode", "verify", "Mode: verify or capture")
+	device := flag.String("device", "", "Serial device to read, e.g. /dev/ttyS1 or a pty:// link")
+	listen := flag.String("listen", "", "TCP address to accept a tcp:// output on, e.g. :9100")
+	connect := flag.String("connect", "", "TCP address of a system serving its feed, e.g. 10.0.0.5:4000")
+	baud := flag.Int("baud", 9600, "Baud rate")
+	stripParity := flag.Bool("strip-parity", false, "Clear bit 7 of every byte received")
+	formatName := flag.String("format", "vesta", "Record format of the feed")
+	pusherURL := flag.String("url", "http://localhost:8080", "PollenPusher monitoring address (verify)")
+	sentDevice := flag.String("sent-device", "", "PollenPusher device feeding this collector (verify)")
+	token := flag.String("token", os.Getenv("POLLENPUSHER_TOKEN"), "PollenPusher API token, if auth is enabled (verify)")
+	caFile := flag.String("ca", "", "PEM CA certificate to trust for an https -url (verify)")
+	grace := flag.Duration("grace", 5*time.Second, "How long to wait for a record's counterpart (verify)")
+	reportEvery := flag.Duration("report", 30*time.Second, "Interval between reports, 0 for only at exit (verify)")
+	outPath := flag.String("out", "", "Sample file to write (capture)")
+	keepFirst := flag.Bool("keep-first", false, "Keep the first record even if it may be cut off (capture)")
+	duration := flag.Duration("duration", 0, "Stop after this long, 0 to run until interrupted")
+	flag.Parse()
+
+	sources := 0
+	for _, s := range []string{*device, *listen, *connect} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		log.Fatal("Specify one of -device, -listen or -connect")
+	}
+	if *mode == "capture" && *outPath == "" {
+		log.Fatal("Capture mode needs -out")
+	}
+
+	f, err := format.Get(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lines := make(chan feedLine, 1024)
+	feed := feedConfig{
+		device:      *device,
+		listen:      *listen,
+		connect:     *connect,
+		baud:        *baud,
+		stripParity: *stripParity,
+	}
+	if err := readFeed(feed, lines); err != nil {
+		log.Fatalf("Failed to open feed: %v", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	var deadline <-chan time.Time
+	if *duration > 0 {
+		deadline = time.After(*duration)
+	}
+
+	switch *mode {
+	case "verify":
+		api, err := newPusherAPI(*pusherURL, *token, *caFile)
+		if err != nil {
+			log.Fatalf("Failed to set up API client: %v", err)
+		}
+		if !verify(f, lines, api, *sentDevice, *grace, *reportEvery, stop, deadline) {
+			os.Exit(1)
+		}
+	case "capture":
+		if !capture(f, lines, *outPath, *keepFirst, stop, deadline) {
+			os.Exit(1)
+		}
+	default:
+		log.Fatal("Invalid mode. Use: verify or capture")
+	}
+}
+
+// verify compares the feed with the records PollenPusher reports sending
+// until stopped. It returns false if any record did not arrive intact and
+// in order.
+func verify(f format.CDRFormat, lines <-chan feedLine, api *pusherAPI, sentDevice string,
+	grace, reportEvery time.Duration, stop <-chan os.Signal, deadline <-chan time.Time) bool {
+
+	events := make(chan output.Event, 1024)
+	connected := make(chan time.Time, 1)
+	go api.streamSent(sentDevice, events, connected)
+
+	v := newVerifier(f, grace)
+	splitter := format.NewSplitter(f)
+
+	expireTicker := time.NewTicker(time.Second)
+	defer expireTicker.Stop()
+
+	var report <-chan time.Time
+	if reportEvery > 0 {
+		reportTicker := time.NewTicker(reportEvery)
+		defer reportTicker.Stop()
+		report = reportTicker.C
+	}
+
+	for {
+		select {
+		case line := <-lines:
+			records, err := splitter.Add(line.text)
+			if err != nil {
+				log.Printf("Parse error: %v", err)
+				continue
+			}
+			for _, record := range records {
+				v.received(record, line.at)
+			}
+		case event := <-events:
+			v.sent(event)
+		case at := <-connected:
+			v.connected(at)
+		case now := <-expireTicker.C:
+			v.expire(now)
+		case <-report:
+			v.report.print()
+		case <-stop:
+			return finishVerify(v, splitter)
+		case <-deadline:
+			return finishVerify(v, splitter)
+		}
+	}
+}
+
+// finishVerify settles the records still waiting and prints the final
+// report
+func finishVerify(v *verifier, splitter *format.Splitter) bool {
+	if records, err := splitter.Flush(); err == nil {
+		for _, record := range records {
+			v.received(record, time.Now())
+		}
+	}
+	v.finish()
+
+	log.Println("Final report:")
+	v.report.print()
+	return v.report.problems() == 0
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cdrgenerator/format"
+	"cdrgenerator/output"
+)
+
+// historyWindow is how long matched records are remembered for spotting
+// duplicates
+const historyWindow = 10 * time.Minute
+
+// sentRecord is a record PollenPusher reported sending. Formats that put
+// several blocks in one record (a Viper call and its agent block) give one
+// sentRecord per block, as the collector sees them.
+type sentRecord struct {
+	seq      int
+	recordID string // As reported by PollenPusher
+	id       string // As parsed from the lines
+	hash     string
+	sentAt   time.Time
+	seenAt   time.Time
+	faults   int
+	matched  time.Time
+}
+
+// receivedRecord is a record the collector parsed from the feed
+type receivedRecord struct {
+	id   string
+	hash string
+	at   time.Time
+}
+
+// verifyReport is the running tally of the comparison
+type verifyReport struct {
+	Sent       int
+	Received   int
+	Matched    int
+	Missing    int
+	Duplicated int
+	Corrupted  int
+	Reordered  int
+	Unexpected int
+	Faulted    int // Sent records PollenPusher deliberately damaged
+	InFlight   int // Still within the grace period when the run ended
+	Latencies  []time.Duration
+}
+
+// problems returns the number of records that did not arrive intact and in
+// order
+func (r *verifyReport) problems() int {
+	return r.Missing + r.Duplicated + r.Corrupted + r.Reordered + r.Unexpected
+}
+
+// print writes the report to stdout
+func (r *verifyReport) print() {
+	fmt.Printf("Sent: %d  Received: %d  Matched: %d\n", r.Sent, r.Received, r.Matched)
+	fmt.Printf("Missing: %d  Duplicated: %d  Corrupted: %d  Reordered: %d  Unexpected: %d\n",
+		r.Missing, r.Duplicated, r.Corrupted, r.Reordered, r.Unexpected)
+	if r.InFlight > 0 {
+		fmt.Printf("Still in flight at exit: %d\n", r.InFlight)
+	}
+	if r.Faulted > 0 {
+		fmt.Printf("Sent with injected faults: %d\n", r.Faulted)
+	}
+
+	if len(r.Latencies) == 0 {
+		return
+	}
+	sorted := append([]time.Duration(nil), r.Latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	fmt.Printf("Latency: min %v  avg %v  p95 %v  max %v\n",
+		sorted[0].Round(time.Millisecond),
+		(total / time.Duration(len(sorted))).Round(time.Millisecond),
+		sorted[len(sorted)*95/100].Round(time.Millisecond),
+		sorted[len(sorted)-1].Round(time.Millisecond),
+	)
+}
+
+// verifier matches records received from the feed against the records
+// PollenPusher reports sending. Either side may be seen first, so records
+// wait up to grace for their counterpart before being reported.
+type verifier struct {
+	format format.CDRFormat
+	grace  time.Duration
+
+	since     time.Time // Records received before the event stream connected are ignored
+	seq       int
+	lastSeq   int // Highest sequence matched so far
+	pending   []*sentRecord
+	unmatched []receivedRecord
+	matchedBy map[string]*sentRecord // Matched records by hash and by parsed ID
+	report    verifyReport
+}
+
+func newVerifier(f format.CDRFormat, grace time.Duration) *verifier {
+	return &verifier{
+		format:    f,
+		grace:     grace,
+		matchedBy: make(map[string]*sentRecord),
+	}
+}
+
+// sent adds a record event from PollenPusher
+func (v *verifier) sent(event output.Event) {
+	records, err := format.ParseLines(v.format, splitLines(event.Data))
+	if err != nil {
+		log.Printf("Failed to parse sent record %s: %v", event.RecordID, err)
+		return
+	}
+
+	now := time.Now()
+	for _, record := range records {
+		v.seq++
+		v.report.Sent++
+		if len(event.Faults) > 0 {
+			v.report.Faulted++
+		}
+		v.pending = append(v.pending, &sentRecord{
+			seq:      v.seq,
+			recordID: event.RecordID,
+			id:       record.ID,
+			hash:     record.ContentHash(),
+			sentAt:   event.Time,
+			seenAt:   now,
+			faults:   len(event.Faults),
+		})
+	}
+
+	// Records that arrived before PollenPusher reported them
+	waiting := v.unmatched
+	v.unmatched = nil
+	for _, r := range waiting {
+		if !v.match(r) {
+			v.unmatched = append(v.unmatched, r)
+		}
+	}
+}
+
+// connected starts the comparison when the event stream first connects
+func (v *verifier) connected(at time.Time) {
+	if v.since.IsZero() {
+		v.since = at
+	}
+}
+
+// received adds a record parsed from the feed
+func (v *verifier) received(record format.CDRRecord, at time.Time) {
+	if v.since.IsZero() || at.Before(v.since) {
+		return
+	}
+	v.report.Received++
+	r := receivedRecord{id: record.ID, hash: record.ContentHash(), at: at}
+	if !v.match(r) {
+		v.unmatched = append(v.unmatched, r)
+	}
+}
+
+// match pairs r with a pending sent record: first by content, then by ID
+// for a record that arrived damaged
+func (v *verifier) match(r receivedRecord) bool {
+	for i, s := range v.pending {
+		if s.hash == r.hash {
+			v.matchedAt(i, r)
+			return true
+		}
+	}
+	if r.id == "" {
+		return false
+	}
+	for i, s := range v.pending {
+		if s.id == r.id {
+			v.report.Corrupted++
+			log.Printf("CORRUPTED record %s", s.describe())
+			v.matchedAt(i, r)
+			return true
+		}
+	}
+	return false
+}
+
+// matchedAt records the match of pending[i] with r
+func (v *verifier) matchedAt(i int, r receivedRecord) {
+	s := v.pending[i]
+	v.pending = append(v.pending[:i], v.pending[i+1:]...)
+
+	s.matched = time.Now()
+	v.matchedBy[s.hash] = s
+	if s.id != "" {
+		v.matchedBy[s.id] = s
+	}
+
+	// PollenPusher stamps a record once the write returns, which for a
+	// socket can be just after the collector has read it
+	latency := r.at.Sub(s.sentAt)
+	if latency < 0 {
+		latency = 0
+	}
+	v.report.Matched++
+	v.report.Latencies = append(v.report.Latencies, latency)
+
+	if s.seq < v.lastSeq {
+		v.report.Reordered++
+		log.Printf("REORDERED record %s arrived after a later record", s.describe())
+	} else {
+		v.lastSeq = s.seq
+	}
+}
+
+// expire reports records whose counterpart has not shown up within the
+// grace period
+func (v *verifier) expire(now time.Time) {
+	var pending []*sentRecord
+	for _, s := range v.pending {
+		if now.Sub(s.seenAt) < v.grace {
+			pending = append(pending, s)
+			continue
+		}
+		v.report.Missing++
+		log.Printf("MISSING record %s", s.describe())
+	}
+	v.pending = pending
+
+	var unmatched []receivedRecord
+	for _, r := range v.unmatched {
+		if now.Sub(r.at) < v.grace {
+			unmatched = append(unmatched, r)
+			continue
+		}
+		if s := v.previous(r); s != nil {
+			v.report.Duplicated++
+			log.Printf("DUPLICATED record %s", s.describe())
+		} else {
+			v.report.Unexpected++
+			log.Printf("UNEXPECTED record %s received", displayID(r.id))
+		}
+	}
+	v.unmatched = unmatched
+
+	for key, s := range v.matchedBy {
+		if now.Sub(s.matched) > historyWindow {
+			delete(v.matchedBy, key)
+		}
+	}
+}
+
+// previous returns the already matched record r repeats, if any
+func (v *verifier) previous(r receivedRecord) *sentRecord {
+	if s, ok := v.matchedBy[r.hash]; ok {
+		return s
+	}
+	if r.id != "" {
+		return v.matchedBy[r.id]
+	}
+	return nil
+}
+
+// finish settles the records whose grace period is over. Those still
+// within it are counted as in flight rather than missing.
+func (v *verifier) finish() {
+	v.expire(time.Now())
+	v.report.InFlight = len(v.pending) + len(v.unmatched)
+}
+
+func (s *sentRecord) describe() string {
+	desc := fmt.Sprintf("%s (sent %s", displayID(s.recordID), s.sentAt.Format("15:04:05.000"))
+	if s.faults > 0 {
+		desc += fmt.Sprintf(", %d injected faults", s.faults)
+	}
+	return desc + ")"
+}
+
+func displayID(id string) string {
+	if id == "" {
+		return "<no id>"
+	}
+	return id
+}
+
+// splitLines splits sent data into lines the same way the feed is read
+func splitLines(data string) []string {
+	var lines []string
+	for _, line := range strings.FieldsFunc(data, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if text := cleanLine([]byte(line)); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return lines
+}
+
+// pusherAPI is how the collector reaches a PollenPusher monitoring server
+type pusherAPI struct {
+	url    string
+	token  string // Sent as a bearer token if set
+	client *http.Client
+}
+
+// newPusherAPI creates the API client. caFile is a PEM file of CAs to
+// trust for an https URL whose certificate is not publicly trusted.
+func newPusherAPI(baseURL, token, caFile string) (*pusherAPI, error) {
+	client := &http.Client{}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	}
+	return &pusherAPI{url: strings.TrimRight(baseURL, "/"), token: token, client: client}, nil
+}
+
+// streamSent follows PollenPusher's event stream for device and sends its
+// record events to events, reconnecting if the stream drops. The time of
+// each connection is sent to connected.
+func (api *pusherAPI) streamSent(device string, events chan<- output.Event, connected chan<- time.Time) {
+	query := url.Values{"events": {output.EventRecord}}
+	if device != "" {
+		query.Set("device", device)
+	}
+	streamURL := api.url + "/api/stream?" + query.Encode()
+
+	for {
+		if err := api.readStream(streamURL, events, connected); err != nil {
+			log.Printf("Event stream: %v (reconnecting)", err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// readStream reads one connection to the event stream until it ends
+func (api *pusherAPI) readStream(streamURL string, events chan<- output.Event, connected chan<- time.Time) error {
+	req, err := http.NewRequest(http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	if api.token != "" {
+		req.Header.Set("Authorization", "Bearer "+api.token)
+	}
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	log.Printf("Following %s", streamURL)
+	connected <- time.Now()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var eventType string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := strings.TrimPrefix(line, "data: ")
+			if eventType == "dropped" {
+				log.Printf("Event stream dropped events, records may be reported missing: %s", data)
+				continue
+			}
+			var event output.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				log.Printf("Bad event: %v", err)
+				continue
+			}
+			events <- event
+		case line == "":
+			eventType = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream closed")
+}
@@ -70,7 +70,8 @@ func receiveTest(cfg serial.PortConfig) {
 	defer port.Close()
 
 	fmt.Printf("Listening on %s at %d baud\n", cfg.Device, cfg.BaudRate)
-	fmt.Println("Press Ctrl+C to stop\n")
+	fmt.Println("Press Ctrl+C to stop")
+	fmt.Println()
 
 	buf := make([]byte, 1024)
 	totalBytes := 0
@@ -99,7 +100,8 @@ func loopbackTest(cfg serial.PortConfig, message string) {
 	defer port.Close()
 
 	fmt.Printf("Loopback test on %s at %d baud\n", cfg.Device, cfg.BaudRate)
-	fmt.Println("Connect pins 2 and 3 (TX and RX) with a jumper\n")
+	fmt.Println("Connect pins 2 and 3 (TX and RX) with a jumper")
+	fmt.Println()
 
 	for i := 0; i < 5; i++ {
 		testMsg := fmt.Sprintf("%s-%d", message, i+1)